@@ -0,0 +1,144 @@
+package badge
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/state"
+)
+
+// ContentType is the content type badges are served and stored with.
+const ContentType = "image/svg+xml"
+
+// CacheControl keeps caches in front of a badge, such as the image proxies
+// of code hosts, from showing a stale state.
+const CacheControl = "no-cache, max-age=0"
+
+const (
+	colorReady   = "#4c1"
+	colorRunning = "#dfb317"
+	colorFailed  = "#e05d44"
+	colorFrozen  = "#007ec6"
+	colorOther   = "#9f9f9f"
+)
+
+// Badge is a two part badge, such as "deploy | running #42".
+type Badge struct {
+	Label   string
+	Message string
+	Color   string
+}
+
+// ForStatus describes a pipeline's status.
+func ForStatus(status *models.PipelineStatus, now time.Time) Badge {
+	return describe(status.Pipeline, status.State, status.BuildNumber,
+		status.Failure != nil, state.IsFrozen(status, now))
+}
+
+// ForPipeline describes one of the statuses in a summary.
+func ForPipeline(pipeline models.PipelineSummary) Badge {
+	label := pipeline.Pipeline
+	if label == "" {
+		label = pipeline.Key
+	}
+
+	return describe(label, pipeline.State, pipeline.BuildNumber, pipeline.Failure != nil, pipeline.Frozen)
+}
+
+// ForSummary describes the overall state of a summary.
+func ForSummary(summary *models.StatusSummary, label string) Badge {
+	return describe(label, summary.State, "", summary.State == models.StateFailed, false)
+}
+
+func describe(label string, pipelineState models.PipelineState, build string, failed bool, frozen bool) Badge {
+	if label == "" {
+		label = "status"
+	}
+
+	badge := Badge{Label: label}
+
+	switch {
+	case frozen:
+		badge.Message, badge.Color = "frozen", colorFrozen
+	case failed:
+		badge.Message, badge.Color = "failed", colorFailed
+	case pipelineState == models.StateRunning:
+		badge.Message, badge.Color = "running", colorRunning
+	case pipelineState == models.StateReady || pipelineState == "":
+		badge.Message, badge.Color = "ready", colorReady
+	default:
+		badge.Message, badge.Color = strings.ToLower(string(pipelineState)), colorOther
+	}
+
+	if build != "" && !frozen && !failed {
+		badge.Message += " #" + build
+	}
+
+	return badge
+}
+
+// SVG renders the badge in the flat style of shields.io.
+func (b Badge) SVG() []byte {
+	labelWidth := textWidth(b.Label) + 10
+	messageWidth := textWidth(b.Message) + 10
+
+	buf := &bytes.Buffer{}
+	svg.Execute(buf, map[string]interface{}{
+		"Badge":        b,
+		"LabelWidth":   labelWidth,
+		"MessageWidth": messageWidth,
+		"Width":        labelWidth + messageWidth,
+		"LabelX":       labelWidth / 2,
+		"MessageX":     labelWidth + messageWidth/2,
+	})
+
+	return buf.Bytes()
+}
+
+// textWidth approximates the width in pixels of text set in 11px Verdana.
+func textWidth(text string) int {
+	width := 0
+	for _, r := range text {
+		switch {
+		case strings.ContainsRune("iljtf.,:;|!' ", r):
+			width += 4
+		case strings.ContainsRune("mwMW", r):
+			width += 10
+		case r >= 'A' && r <= 'Z':
+			width += 8
+		default:
+			width += 7
+		}
+	}
+
+	return width
+}
+
+func escape(text string) string {
+	buf := &bytes.Buffer{}
+	xml.EscapeText(buf, []byte(text))
+	return buf.String()
+}
+
+var svg = template.Must(template.New("badge").Funcs(template.FuncMap{"escape": escape}).Parse(
+	`<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="20" role="img" aria-label="{{escape .Badge.Label}}: {{escape .Badge.Message}}">
+<title>{{escape .Badge.Label}}: {{escape .Badge.Message}}</title>
+<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<clipPath id="r"><rect width="{{.Width}}" height="20" rx="3" fill="#fff"/></clipPath>
+<g clip-path="url(#r)">
+<rect width="{{.LabelWidth}}" height="20" fill="#555"/>
+<rect x="{{.LabelWidth}}" width="{{.MessageWidth}}" height="20" fill="{{.Badge.Color}}"/>
+<rect width="{{.Width}}" height="20" fill="url(#s)"/>
+</g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+<text x="{{.LabelX}}" y="15" fill="#010101" fill-opacity=".3">{{escape .Badge.Label}}</text>
+<text x="{{.LabelX}}" y="14">{{escape .Badge.Label}}</text>
+<text x="{{.MessageX}}" y="15" fill="#010101" fill-opacity=".3">{{escape .Badge.Message}}</text>
+<text x="{{.MessageX}}" y="14">{{escape .Badge.Message}}</text>
+</g>
+</svg>
+`))
@@ -0,0 +1,13 @@
+package badge_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestBadge(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Badge Suite")
+}
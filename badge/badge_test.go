@@ -0,0 +1,58 @@
+package badge_test
+
+import (
+	"encoding/xml"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/pivotalservices/pipeline-status-resource/badge"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+)
+
+var _ = Describe("Badges", func() {
+	now := time.Date(2017, 9, 18, 10, 0, 0, 0, time.UTC)
+
+	DescribeTable("describing a status",
+		func(status models.PipelineStatus, message string, color string) {
+			status.Pipeline = "deploy"
+			status.BuildNumber = "42"
+
+			b := badge.ForStatus(&status, now)
+			Expect(b.Label).To(Equal("deploy"))
+			Expect(b.Message).To(Equal(message))
+			Expect(b.Color).To(Equal(color))
+		},
+		Entry("ready", models.PipelineStatus{State: models.StateReady}, "ready #42", "#4c1"),
+		Entry("running", models.PipelineStatus{State: models.StateRunning}, "running #42", "#dfb317"),
+		Entry("failed", models.PipelineStatus{State: models.StateReady, Failure: &models.BuildFailure{}}, "failed", "#e05d44"),
+		Entry("frozen", models.PipelineStatus{State: models.StateReady, Freeze: &models.PipelineFreeze{}}, "frozen", "#007ec6"),
+		Entry("custom states", models.PipelineStatus{State: "PAUSED"}, "paused #42", "#9f9f9f"),
+	)
+
+	It("renders well formed SVG with escaped text", func() {
+		svg := badge.Badge{Label: "a<b", Message: "ready & #1", Color: "#4c1"}.SVG()
+
+		var doc struct {
+			XMLName xml.Name
+			Title   string `xml:"title"`
+		}
+		Expect(xml.Unmarshal(svg, &doc)).To(Succeed())
+		Expect(doc.XMLName.Local).To(Equal("svg"))
+		Expect(doc.Title).To(Equal("a<b: ready & #1"))
+	})
+
+	It("widens with its text", func() {
+		short := badge.Badge{Label: "a", Message: "ready"}.SVG()
+		long := badge.Badge{Label: "a much longer pipeline name", Message: "ready"}.SVG()
+		Expect(len(long)).To(BeNumerically(">", len(short)))
+		Expect(string(short)).To(ContainSubstring(`width="62"`))
+	})
+
+	It("describes a summary", func() {
+		b := badge.ForSummary(&models.StatusSummary{State: models.StateFailed}, "release")
+		Expect(b.Message).To(Equal("failed"))
+		Expect(b.Label).To(Equal("release"))
+	})
+})
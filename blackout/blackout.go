@@ -0,0 +1,201 @@
+package blackout
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pivotalservices/pipeline-status-resource/models"
+)
+
+// maxCronDuration bounds how far back a cron window is searched for the
+// firing that covers a point in time. Longer periods should use a freeze.
+const maxCronDuration = 7 * 24 * time.Hour
+
+// minCronDuration is the shortest cron window, as crons fire at most once a
+// minute.
+const minCronDuration = time.Minute
+
+// Window is a single recurring blackout period.
+type Window struct {
+	Name string
+
+	location *time.Location
+
+	cron     *cronSpec
+	duration time.Duration
+
+	days  map[time.Weekday]bool
+	start time.Duration
+	end   time.Duration
+}
+
+// Schedule is the set of blackout windows configured for a pipeline.
+type Schedule struct {
+	Windows []*Window
+}
+
+// FromSource parses the blackout windows declared in the source.
+func FromSource(windows []models.BlackoutWindow) (*Schedule, error) {
+	schedule := &Schedule{}
+
+	for i, w := range windows {
+		window, err := NewWindow(w)
+		if err != nil {
+			name := w.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+			return nil, fmt.Errorf("invalid blackout window %s: %s", name, err)
+		}
+		schedule.Windows = append(schedule.Windows, window)
+	}
+
+	return schedule, nil
+}
+
+// NewWindow parses a single blackout window.
+func NewWindow(w models.BlackoutWindow) (*Window, error) {
+	window := &Window{
+		Name:     w.Name,
+		location: time.UTC,
+	}
+
+	if w.Timezone != "" {
+		location, err := time.LoadLocation(w.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		window.location = location
+	}
+
+	if w.Cron != "" {
+		if w.Start != "" || w.End != "" || len(w.Days) > 0 {
+			return nil, fmt.Errorf("cron cannot be combined with days, start or end")
+		}
+
+		var err error
+		if window.cron, err = parseCron(w.Cron); err != nil {
+			return nil, err
+		}
+
+		if window.duration, err = time.ParseDuration(w.Duration); err != nil {
+			return nil, fmt.Errorf("a cron window needs a duration: %s", err)
+		}
+		if window.duration < minCronDuration || window.duration > maxCronDuration {
+			return nil, fmt.Errorf("duration must be between %s and %s", minCronDuration, maxCronDuration)
+		}
+
+		return window, nil
+	}
+
+	if w.Start == "" || w.End == "" {
+		return nil, fmt.Errorf("either cron and duration, or start and end must be set")
+	}
+
+	var err error
+	if window.start, err = parseTimeOfDay(w.Start); err != nil {
+		return nil, err
+	}
+	if window.end, err = parseTimeOfDay(w.End); err != nil {
+		return nil, err
+	}
+	if window.start == window.end {
+		return nil, fmt.Errorf("start and end cannot both be %s, a window needs a length", w.Start)
+	}
+
+	if len(w.Days) > 0 {
+		window.days = map[time.Weekday]bool{}
+		for _, d := range w.Days {
+			name := strings.ToUpper(d)
+			if len(name) > 3 {
+				name = name[:3]
+			}
+
+			day, ok := weekdayNames[name]
+			if !ok {
+				return nil, fmt.Errorf("invalid day %q", d)
+			}
+			window.days[time.Weekday(day)] = true
+		}
+	}
+
+	return window, nil
+}
+
+// Active returns the window covering the given time. When several windows
+// overlap, the one that ends last is returned.
+func (s *Schedule) Active(now time.Time) (window *Window, ends time.Time, active bool) {
+	if s == nil {
+		return nil, time.Time{}, false
+	}
+
+	for _, w := range s.Windows {
+		if e, ok := w.Covers(now); ok && e.After(ends) {
+			window, ends, active = w, e, true
+		}
+	}
+
+	return
+}
+
+// Covers reports whether the window covers the given time and, if so, when
+// that occurrence of the window ends.
+func (w *Window) Covers(now time.Time) (ends time.Time, covered bool) {
+	now = now.In(w.location)
+
+	if w.cron != nil {
+		minute := now.Truncate(time.Minute)
+		for t := minute; now.Sub(t) < w.duration; t = t.Add(-time.Minute) {
+			if w.cron.matches(t) {
+				return t.Add(w.duration), true
+			}
+		}
+
+		return time.Time{}, false
+	}
+
+	year, month, day := now.Date()
+	for offset := 0; offset >= -1; offset-- {
+		midnight := time.Date(year, month, day+offset, 0, 0, 0, 0, w.location)
+		if w.days != nil && !w.days[midnight.Weekday()] {
+			continue
+		}
+
+		start := atTimeOfDay(midnight, w.start)
+		end := atTimeOfDay(midnight, w.end)
+		if !end.After(start) {
+			end = atTimeOfDay(midnight.AddDate(0, 0, 1), w.end)
+		}
+
+		if !now.Before(start) && now.Before(end) {
+			return end, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// Describe returns the window's name, or a generic description when it has
+// none.
+func (w *Window) Describe() string {
+	if w.Name != "" {
+		return w.Name
+	}
+
+	return "blackout window"
+}
+
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", value)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func atTimeOfDay(midnight time.Time, offset time.Duration) time.Time {
+	return time.Date(midnight.Year(), midnight.Month(), midnight.Day(),
+		int(offset/time.Hour), int(offset%time.Hour/time.Minute), 0, 0, midnight.Location())
+}
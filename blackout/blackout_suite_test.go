@@ -0,0 +1,13 @@
+package blackout_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestBlackout(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Blackout Suite")
+}
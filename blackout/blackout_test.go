@@ -0,0 +1,154 @@
+package blackout_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/pivotalservices/pipeline-status-resource/blackout"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+)
+
+var _ = Describe("Blackout Windows", func() {
+	at := func(value string) time.Time {
+		t, err := time.Parse(time.RFC3339, value)
+		Expect(err).NotTo(HaveOccurred())
+		return t
+	}
+
+	schedule := func(windows ...models.BlackoutWindow) *blackout.Schedule {
+		s, err := blackout.FromSource(windows)
+		Expect(err).NotTo(HaveOccurred())
+		return s
+	}
+
+	Context("with a cron window", func() {
+		var s *blackout.Schedule
+
+		BeforeEach(func() {
+			// Fridays at 17:30 for the weekend
+			s = schedule(models.BlackoutWindow{
+				Name:     "weekend",
+				Cron:     "30 17 * * FRI",
+				Duration: "62h30m",
+			})
+		})
+
+		It("is active after the cron fires", func() {
+			// 2017-09-15 is a Friday
+			window, ends, active := s.Active(at("2017-09-16T12:00:00Z"))
+			Expect(active).To(BeTrue())
+			Expect(window.Describe()).To(Equal("weekend"))
+			Expect(ends).To(BeTemporally("==", at("2017-09-18T08:00:00Z")))
+		})
+
+		It("is inactive before the cron fires", func() {
+			_, _, active := s.Active(at("2017-09-15T17:29:00Z"))
+			Expect(active).To(BeFalse())
+		})
+
+		It("is inactive once the duration has passed", func() {
+			_, _, active := s.Active(at("2017-09-18T08:00:00Z"))
+			Expect(active).To(BeFalse())
+		})
+	})
+
+	DescribeTable("matches cron expressions",
+		func(expr string, when string, active bool) {
+			s := schedule(models.BlackoutWindow{Cron: expr, Duration: "1m"})
+			_, _, covered := s.Active(at(when))
+			Expect(covered).To(Equal(active))
+		},
+		Entry("steps", "*/15 * * * *", "2017-09-18T10:45:00Z", true),
+		Entry("steps miss", "*/15 * * * *", "2017-09-18T10:46:00Z", false),
+		Entry("lists and ranges", "0 9-17/4,22 * * *", "2017-09-18T13:00:00Z", true),
+		Entry("lists and ranges miss", "0 9-17/4,22 * * *", "2017-09-18T14:00:00Z", false),
+		Entry("sunday as 7", "0 0 * * 7", "2017-09-17T00:00:00Z", true),
+		Entry("month names", "0 0 1 JAN *", "2017-01-01T00:00:00Z", true),
+		Entry("day of month or week", "0 0 13 * FRI", "2017-09-15T00:00:00Z", true),
+		Entry("day of month or week miss", "0 0 13 * FRI", "2017-09-14T00:00:00Z", false),
+		Entry("every day of month as a step", "0 0 */1 * FRI", "2017-09-14T00:00:00Z", false),
+		Entry("every day of month as a range", "0 0 1-31 * FRI", "2017-09-15T00:00:00Z", true),
+		Entry("every day of month as a range miss", "0 0 1-31 * FRI", "2017-09-14T00:00:00Z", false),
+		Entry("every day of week as a range", "0 0 13 * 0-6", "2017-09-14T00:00:00Z", false),
+	)
+
+	Context("with a time range", func() {
+		It("covers the range on the listed days", func() {
+			s := schedule(models.BlackoutWindow{
+				Days:  []string{"Monday", "tue"},
+				Start: "09:00",
+				End:   "11:00",
+			})
+
+			_, ends, active := s.Active(at("2017-09-18T10:00:00Z"))
+			Expect(active).To(BeTrue())
+			Expect(ends).To(BeTemporally("==", at("2017-09-18T11:00:00Z")))
+
+			_, _, active = s.Active(at("2017-09-20T10:00:00Z"))
+			Expect(active).To(BeFalse())
+		})
+
+		It("wraps past midnight", func() {
+			s := schedule(models.BlackoutWindow{
+				Days:  []string{"SUN"},
+				Start: "22:00",
+				End:   "02:00",
+			})
+
+			_, ends, active := s.Active(at("2017-09-18T01:00:00Z"))
+			Expect(active).To(BeTrue())
+			Expect(ends).To(BeTemporally("==", at("2017-09-18T02:00:00Z")))
+		})
+
+		It("evaluates the range in the configured timezone", func() {
+			s := schedule(models.BlackoutWindow{
+				Start:    "09:00",
+				End:      "17:00",
+				Timezone: "America/New_York",
+			})
+
+			_, _, active := s.Active(at("2017-09-18T10:00:00Z"))
+			Expect(active).To(BeFalse())
+
+			_, ends, active := s.Active(at("2017-09-18T14:00:00Z"))
+			Expect(active).To(BeTrue())
+			Expect(ends).To(BeTemporally("==", at("2017-09-18T21:00:00Z")))
+		})
+	})
+
+	It("reports the overlapping window that ends last", func() {
+		s := schedule(
+			models.BlackoutWindow{Name: "short", Start: "09:00", End: "10:00"},
+			models.BlackoutWindow{Name: "long", Start: "08:00", End: "12:00"},
+		)
+
+		window, _, active := s.Active(at("2017-09-18T09:30:00Z"))
+		Expect(active).To(BeTrue())
+		Expect(window.Describe()).To(Equal("long"))
+	})
+
+	It("is never active without windows", func() {
+		_, _, active := schedule().Active(time.Now())
+		Expect(active).To(BeFalse())
+	})
+
+	DescribeTable("rejects invalid windows",
+		func(window models.BlackoutWindow, message string) {
+			_, err := blackout.FromSource([]models.BlackoutWindow{window})
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("no schedule", models.BlackoutWindow{Name: "empty"}, "invalid blackout window empty"),
+		Entry("bad cron", models.BlackoutWindow{Cron: "61 * * * *", Duration: "1h"}, "invalid minute"),
+		Entry("short cron", models.BlackoutWindow{Cron: "* * *", Duration: "1h"}, "must have 5 fields"),
+		Entry("cron without duration", models.BlackoutWindow{Cron: "0 0 * * *"}, "needs a duration"),
+		Entry("short duration", models.BlackoutWindow{Cron: "0 0 * * *", Duration: "30s"}, "duration must be between 1m0s and 168h0m0s"),
+		Entry("long duration", models.BlackoutWindow{Cron: "0 0 * * *", Duration: "169h"}, "duration must be between 1m0s and 168h0m0s"),
+		Entry("mixed", models.BlackoutWindow{Cron: "0 0 * * *", Duration: "1h", Start: "01:00"}, "cannot be combined"),
+		Entry("bad time", models.BlackoutWindow{Start: "25:00", End: "01:00"}, "expected HH:MM"),
+		Entry("empty range", models.BlackoutWindow{Start: "01:00", End: "01:00"}, "start and end cannot both be 01:00"),
+		Entry("bad day", models.BlackoutWindow{Days: []string{"Funday"}, Start: "01:00", End: "02:00"}, "invalid day"),
+		Entry("bad timezone", models.BlackoutWindow{Start: "01:00", End: "02:00", Timezone: "Mars/Olympus"}, "Mars/Olympus"),
+	)
+})
@@ -0,0 +1,173 @@
+package blackout
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSpec is a parsed five field cron expression: minute, hour, day of
+// month, month and day of week.
+type cronSpec struct {
+	minutes  map[int]bool
+	hours    map[int]bool
+	days     map[int]bool
+	months   map[int]bool
+	weekdays map[int]bool
+
+	anyDay     bool
+	anyWeekday bool
+}
+
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	minuteField = cronField{name: "minute", min: 0, max: 59}
+	hourField   = cronField{name: "hour", min: 0, max: 23}
+	dayField    = cronField{name: "day of month", min: 1, max: 31}
+	monthField  = cronField{name: "month", min: 1, max: 12, names: map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}}
+	weekdayField = cronField{name: "day of week", min: 0, max: 7, names: weekdayNames}
+)
+
+var weekdayNames = map[string]int{
+	"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+}
+
+func parseCron(expr string) (*cronSpec, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields, found %d", expr, len(fields))
+	}
+
+	spec := &cronSpec{}
+
+	var err error
+	if spec.minutes, err = minuteField.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if spec.hours, err = hourField.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	if spec.days, err = dayField.parse(fields[2]); err != nil {
+		return nil, err
+	}
+	if spec.months, err = monthField.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if spec.weekdays, err = weekdayField.parse(fields[4]); err != nil {
+		return nil, err
+	}
+
+	// Sunday can be written as either 0 or 7.
+	if spec.weekdays[7] {
+		spec.weekdays[0] = true
+	}
+
+	// A field allowing every value, however it is written, e.g. */1 or
+	// 1-31, does not restrict the day. Weekdays stop at 6, Sunday being 0.
+	spec.anyDay = dayField.covers(spec.days, dayField.max)
+	spec.anyWeekday = weekdayField.covers(spec.weekdays, 6)
+
+	return spec, nil
+}
+
+// matches reports whether the cron expression fires at the minute t falls in.
+func (c *cronSpec) matches(t time.Time) bool {
+	if !c.minutes[t.Minute()] || !c.hours[t.Hour()] || !c.months[int(t.Month())] {
+		return false
+	}
+
+	day := c.days[t.Day()]
+	weekday := c.weekdays[int(t.Weekday())]
+
+	// As in standard cron, when both the day of month and the day of week
+	// are restricted, matching either one is enough.
+	switch {
+	case c.anyDay && c.anyWeekday:
+		return true
+	case c.anyDay:
+		return weekday
+	case c.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
+
+func (f cronField) parse(value string) (map[int]bool, error) {
+	values := map[int]bool{}
+
+	for _, part := range strings.Split(value, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step in %s field %q", f.name, value)
+			}
+			part = part[:i]
+		}
+
+		low, high := f.min, f.max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+
+			var err error
+			if low, err = f.value(bounds[0]); err != nil {
+				return nil, err
+			}
+
+			high = low
+			if len(bounds) == 2 {
+				if high, err = f.value(bounds[1]); err != nil {
+					return nil, err
+				}
+			} else if step > 1 {
+				high = f.max
+			}
+
+			if high < low {
+				return nil, fmt.Errorf("invalid range in %s field %q", f.name, value)
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			values[v] = true
+		}
+	}
+
+	return values, nil
+}
+
+// covers reports whether the values hold every value of the field up to max.
+func (f cronField) covers(values map[int]bool, max int) bool {
+	for v := f.min; v <= max; v++ {
+		if !values[v] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (f cronField) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToUpper(s)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s %q, expected a value between %d and %d", f.name, s, f.min, f.max)
+	}
+
+	return v, nil
+}
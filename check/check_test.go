@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -56,6 +57,7 @@ var _ = Describe("Check", func() {
 		var request models.CheckRequest
 		var response models.CheckResponse
 		var svc *s3.S3
+		var checkSession *gexec.Session
 
 		BeforeEach(func() {
 			guid, err := uuid.NewV4()
@@ -99,16 +101,16 @@ var _ = Describe("Check", func() {
 			stdin, err := checkCmd.StdinPipe()
 			Expect(err).NotTo(HaveOccurred())
 
-			session, err := gexec.Start(checkCmd, GinkgoWriter, GinkgoWriter)
+			checkSession, err = gexec.Start(checkCmd, GinkgoWriter, GinkgoWriter)
 			Expect(err).NotTo(HaveOccurred())
 
 			err = json.NewEncoder(stdin).Encode(request)
 			Expect(err).NotTo(HaveOccurred())
 
 			// account for roundtrip to s3
-			Eventually(session, 5*time.Second).Should(gexec.Exit(0))
+			Eventually(checkSession, 5*time.Second).Should(gexec.Exit(0))
 
-			err = json.Unmarshal(session.Out.Contents(), &response)
+			err = json.Unmarshal(checkSession.Out.Contents(), &response)
 			Expect(err).NotTo(HaveOccurred())
 		})
 
@@ -124,6 +126,52 @@ var _ = Describe("Check", func() {
 			Expect(err).NotTo(HaveOccurred())
 		}
 
+		Context("with debug enabled", func() {
+			var debugTmp string
+			var oldDumps []string
+
+			BeforeEach(func() {
+				var err error
+				oldDumps, err = filepath.Glob("/tmp/checkdbg*")
+				Expect(err).NotTo(HaveOccurred())
+
+				debugTmp, err = ioutil.TempDir(tmpdir, "debug")
+				Expect(err).NotTo(HaveOccurred())
+				checkCmd.Env = append(os.Environ(), "TMPDIR="+debugTmp)
+
+				request.Source.Debug = "true"
+				request.Source.PrivateKey = "private-key-not-to-leak"
+				request.Source.Password = "password-not-to-leak"
+				request.Source.JSONKey = "json-key-not-to-leak"
+				request.Source.OpenStack.APIKey = "api-key-not-to-leak"
+				request.Source.Notifications = []models.Notification{
+					{URL: "https://hooks.slack.com/services/T0000/B0000/token-not-to-leak", Format: "slack"},
+				}
+				putStatus("123", models.StateReady)
+			})
+
+			It("logs the request without its secrets", func() {
+				stderr := string(checkSession.Err.Contents())
+				Expect(stderr).To(ContainSubstring(`msg="Received request"`))
+				Expect(stderr).To(ContainSubstring("[REDACTED]"))
+
+				for _, secret := range []string{secretAccessKey, "private-key-not-to-leak", "password-not-to-leak",
+					"json-key-not-to-leak", "api-key-not-to-leak", "hooks.slack.com/services", "token-not-to-leak"} {
+					Expect(stderr).NotTo(ContainSubstring(secret))
+				}
+			})
+
+			It("writes nothing to disk", func() {
+				files, err := ioutil.ReadDir(debugTmp)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(files).To(BeEmpty())
+
+				dumps, err := filepath.Glob("/tmp/checkdbg*")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(dumps).To(Equal(oldDumps))
+			})
+		})
+
 		Context("with no version", func() {
 			BeforeEach(func() {
 				request.Version.Number = ""
@@ -2,16 +2,18 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
-	"io/ioutil"
 	"os"
 
 	"github.com/pivotalservices/pipeline-status-resource/driver"
+	"github.com/pivotalservices/pipeline-status-resource/logger"
 	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/redact"
 )
 
 var VERSION = "local-build"
 
+var log = logger.Default
+
 func main() {
 	var request models.CheckRequest
 	err := json.NewDecoder(os.Stdin).Decode(&request)
@@ -19,35 +21,29 @@ func main() {
 		fatal("reading request", err)
 	}
 
-	if driver.IsDebug(request.Source) {
-		if tmpFile, err := ioutil.TempFile("/tmp", "checkdbg"); err == nil {
-			json.NewEncoder(tmpFile).Encode(request)
-		} else {
-			fmt.Fprintf(os.Stderr, "Error writing debug output: %v\n", err)
-		}
-	}
+	// An invalid log_level is reported when the driver is constructed.
+	log, _ = logger.FromSource(request.Source)
+	log.Debug("Received request", "request", redact.Request(request))
 
-	driver, err := driver.FromSource(request.Source)
+	d, err := driver.FromSource(request.Source)
 	if err != nil {
 		fatal("constructing driver", err)
 	}
 
-	versions, err := driver.Check(request.Version.Number)
+	versions, err := d.Check(request.Version.Number)
 	if err != nil {
 		fatal("checking for new versions", err)
 	}
 
 	delta := models.CheckResponse{}
 	for _, v := range versions {
-		delta = append(delta, models.Version{
-			Number: v,
-		})
+		delta = append(delta, v)
 	}
 
 	json.NewEncoder(os.Stdout).Encode(delta)
 }
 
 func fatal(doing string, err error) {
-	println("error " + doing + ": " + err.Error())
+	log.Error("error "+doing, "error", err)
 	os.Exit(1)
 }
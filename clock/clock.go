@@ -0,0 +1,33 @@
+package clock
+
+import "time"
+
+// Clock tells the time. Code that makes decisions based on the current time
+// takes a Clock so tests can control what "now" is.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// System returns a Clock backed by the system time.
+func System() Clock {
+	return systemClock{}
+}
+
+type fixedClock struct {
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time {
+	return c.now
+}
+
+// Fixed returns a Clock that always reports the given time.
+func Fixed(now time.Time) Clock {
+	return fixedClock{now: now}
+}
@@ -0,0 +1,358 @@
+package driver
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adammck/venv"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/state"
+)
+
+// Summarizer is implemented by drivers that track several statuses as one.
+type Summarizer interface {
+	Summary() (*models.StatusSummary, error)
+
+	// Ready reports whether every status can be started. The summary is
+	// FAILED while any status records a failure, so it cannot tell.
+	Ready() (bool, error)
+}
+
+// Lister is implemented by services that can list the keys under a prefix.
+type Lister interface {
+	ListObjectsV2(*s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error)
+}
+
+// Deleter is implemented by services that can remove a stored status.
+type Deleter interface {
+	DeleteObject(*s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error)
+}
+
+// AggregateDriver tracks the statuses stored under several keys, or under
+// every key with a prefix, as one. Actions are applied to each key in key
+// order, by one build at a time. S3 has no transactions, so when an action
+// fails on one key the statuses already changed are restored to what they
+// were before.
+type AggregateDriver struct {
+	Base   S3Driver
+	Keys   []string
+	Prefix string
+}
+
+func (driver *AggregateDriver) Summary() (*models.StatusSummary, error) {
+	keys, statuses, err := driver.statuses()
+	if err != nil {
+		return nil, err
+	}
+
+	return state.Summarize(keys, statuses, driver.Base.now()), nil
+}
+
+// statuses loads the status of every key.
+func (driver *AggregateDriver) statuses() ([]string, []*models.PipelineStatus, error) {
+	drivers, err := driver.drivers()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys := make([]string, 0, len(drivers))
+	statuses := make([]*models.PipelineStatus, 0, len(drivers))
+	for _, d := range drivers {
+		status, _, err := load(d)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		keys = append(keys, d.Key)
+		statuses = append(statuses, status)
+	}
+
+	return keys, statuses, nil
+}
+
+func (driver *AggregateDriver) Ready() (bool, error) {
+	drivers, err := driver.drivers()
+	if err != nil {
+		return false, err
+	}
+
+	for _, d := range drivers {
+		status, _, err := load(d)
+		if err != nil {
+			return false, err
+		}
+
+		if !state.HasFreeSlot(status, d.Slots) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (driver *AggregateDriver) Check(cursor string) ([]models.Version, error) {
+	keys, statuses, err := driver.statuses()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, key := range keys {
+		d := driver.Base
+		d.Key = key
+		d.checkLongLock(key, statuses[i])
+	}
+	summary := state.Summarize(keys, statuses, driver.Base.now())
+
+	versions := make([]models.Version, 0, 1)
+
+	current, _ := strconv.Atoi(summary.BuildNumber)
+	previous, err := strconv.Atoi(cursor)
+	if cursor == "" || err != nil || current >= previous {
+		versions = append(versions, models.Version{Number: summary.BuildNumber})
+	}
+
+	return versions, nil
+}
+
+func (driver *AggregateDriver) Load(status *models.PipelineStatus) (bool, error) {
+	summary, err := driver.Summary()
+	if err != nil {
+		return false, err
+	}
+
+	*status = *state.SummaryStatus(summary)
+	return true, nil
+}
+
+// Start takes every key, refusing keys that are already running so that the
+// lock on all of them is held by one build or none.
+func (driver *AggregateDriver) Start() (*models.PipelineStatus, error) {
+	return driver.apply(models.Start, func(d *S3Driver) error {
+		status, _, err := load(d)
+		if err != nil {
+			return err
+		}
+
+		if !state.HasFreeSlot(status, d.Slots) {
+			return fmt.Errorf("it is already %s", status.State)
+		}
+
+		_, err = d.Start()
+		return err
+	})
+}
+
+func (driver *AggregateDriver) Finish(force bool) (*models.PipelineStatus, error) {
+	return driver.apply(models.Finish, func(d *S3Driver) error {
+		_, err := d.Finish(force)
+		return err
+	})
+}
+
+func (driver *AggregateDriver) Fail(force bool) (*models.PipelineStatus, error) {
+	return driver.apply(models.Fail, func(d *S3Driver) error {
+		_, err := d.Fail(force)
+		return err
+	})
+}
+
+func (driver *AggregateDriver) SetState(pipelineState models.PipelineState) (*models.PipelineStatus, error) {
+	return driver.apply(models.SetState, func(d *S3Driver) error {
+		_, err := d.SetState(pipelineState)
+		return err
+	})
+}
+
+func (driver *AggregateDriver) Freeze(reason string, expires time.Time) (*models.PipelineStatus, error) {
+	return driver.apply(models.Freeze, func(d *S3Driver) error {
+		_, err := d.Freeze(reason, expires)
+		return err
+	})
+}
+
+func (driver *AggregateDriver) Unfreeze() (*models.PipelineStatus, error) {
+	return driver.apply(models.Unfreeze, func(d *S3Driver) error {
+		_, err := d.Unfreeze()
+		return err
+	})
+}
+
+func (driver *AggregateDriver) ForceReady(reason string) (*models.PipelineStatus, error) {
+	return driver.apply(models.ForceReady, func(d *S3Driver) error {
+		_, err := d.ForceReady(reason)
+		return err
+	})
+}
+
+func (driver *AggregateDriver) Enqueue(enqueued time.Time, priority int) (int, error) {
+	return 0, fmt.Errorf("Cannot queue for several keys at once, queue and priority need a single key")
+}
+
+func (driver *AggregateDriver) SetWaitStart(since time.Time) {
+	driver.Base.SetWaitStart(since)
+}
+
+func (driver *AggregateDriver) SetEnv(env venv.Env) {
+	driver.Base.SetEnv(env)
+}
+
+// apply runs the action against every key while holding a claim on them,
+// restoring the keys already changed when it fails on one of them.
+func (driver *AggregateDriver) apply(action models.StatusAction, fn func(*S3Driver) error) (*models.PipelineStatus, error) {
+	drivers, err := driver.drivers()
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := driver.claim(action, drivers)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	previous := make([]*models.PipelineStatus, len(drivers))
+	for i, d := range drivers {
+		status, found, err := load(d)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			previous[i] = status
+		}
+	}
+
+	for i, d := range drivers {
+		if err := fn(d); err != nil {
+			if failed := driver.restore(drivers[:i], previous[:i]); len(failed) > 0 {
+				return nil, fmt.Errorf("Cannot %s %s: %s, and these keys were left changed: %s",
+					action, d.Key, err, strings.Join(failed, ", "))
+			}
+
+			return nil, fmt.Errorf("Cannot %s %s, none of the keys were changed: %s", action, d.Key, err)
+		}
+	}
+
+	status := &models.PipelineStatus{}
+	if _, err := driver.Load(status); err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// restore writes back the statuses the drivers held before an action, and
+// removes the ones the action created. It carries on past the keys it cannot
+// restore, and describes each of them with its error.
+func (driver *AggregateDriver) restore(drivers []*S3Driver, previous []*models.PipelineStatus) []string {
+	failed := []string{}
+	for i := len(drivers) - 1; i >= 0; i-- {
+		if err := restoreKey(drivers[i], previous[i]); err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%s)", drivers[i].Key, err))
+		}
+	}
+
+	return failed
+}
+
+func restoreKey(d *S3Driver, previous *models.PipelineStatus) error {
+	if previous != nil {
+		return d.persist(previous)
+	}
+
+	deleter, ok := d.Svc.(Deleter)
+	if !ok {
+		return fmt.Errorf("Cannot remove the status created at %s", d.Key)
+	}
+
+	done := d.Log.Timed("Removed status", "bucket", d.BucketName, "key", d.Key)
+	_, err := deleter.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(d.BucketName),
+		Key:    aws.String(d.Key),
+	})
+	done(err)
+	return err
+}
+
+// drivers returns a driver for each tracked key, sorted by key so that
+// concurrent builds take the locks in the same order.
+func (driver *AggregateDriver) drivers() ([]*S3Driver, error) {
+	keys := []string{}
+	for _, key := range driver.Keys {
+		expanded, err := ExpandKey(key, driver.Base.Env)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, expanded)
+	}
+
+	if driver.Prefix != "" {
+		listed, err := driver.list()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, listed...)
+	}
+
+	sort.Strings(keys)
+
+	drivers := []*S3Driver{}
+	for i, key := range keys {
+		if i > 0 && keys[i-1] == key {
+			continue
+		}
+
+		d := driver.Base
+		d.Key = key
+		drivers = append(drivers, &d)
+	}
+
+	if len(drivers) == 0 {
+		return nil, fmt.Errorf("No statuses found under key_prefix %s", driver.Prefix)
+	}
+
+	return drivers, nil
+}
+
+func (driver *AggregateDriver) list() ([]string, error) {
+	prefix, err := ExpandKey(driver.Prefix, driver.Base.Env)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := driver.Base.Svc.(Lister); !ok {
+		return nil, fmt.Errorf("key_prefix is not supported by this driver")
+	}
+
+	listed, err := driver.Base.listKeys(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for _, key := range listed {
+		// Badges, queue tickets, claims and long lock checks are stored next
+		// to the statuses they belong to.
+		if key != BadgeKey(key) && !IsTicketKey(key) && !IsLockKey(key) && !IsLongLockKey(key) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+// load reads the driver's status, reporting whether one was stored.
+func load(d *S3Driver) (status *models.PipelineStatus, found bool, err error) {
+	status = &models.PipelineStatus{}
+
+	ok, err := d.Load(status)
+	if !ok {
+		return nil, false, err
+	}
+
+	return status, err == nil, nil
+}
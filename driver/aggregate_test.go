@@ -0,0 +1,165 @@
+package driver_test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotalservices/pipeline-status-resource/driver"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+)
+
+var _ = Describe("Aggregate Driver", func() {
+	var (
+		s *driver.MemoryServicer
+		d *driver.AggregateDriver
+	)
+
+	BeforeEach(func() {
+		s = driver.NewMemoryServicer(map[string]string{
+			"status/a.yml": "team: foo\npipeline: a\nbuild: \"3\"\nstate: READY\n",
+			"status/b.yml": "team: foo\npipeline: b\nbuild: \"4\"\nstate: READY\n",
+			"other.yml":    "team: foo\npipeline: other\nbuild: \"9\"\nstate: RUNNING\n",
+		})
+		d = &driver.AggregateDriver{
+			Base: driver.S3Driver{Svc: s, Env: mockEnv, SharedLock: true},
+			Keys: []string{"status/b.yml", "status/a.yml"},
+		}
+	})
+
+	It("summarizes every key", func() {
+		summary, err := d.Summary()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summary.State).To(Equal(models.StateReady))
+		Expect(summary.BuildNumber).To(Equal("7"))
+		Expect(summary.Pipelines[0].Key).To(Equal("status/a.yml"))
+		Expect(summary.Pipelines[1].Key).To(Equal("status/b.yml"))
+
+		versions, err := d.Check("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(versions).To(Equal([]models.Version{{Number: "7"}}))
+
+		versions, err = d.Check("12")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(versions).To(BeEmpty())
+	})
+
+	It("is ready while a key has failed but none is running", func() {
+		store(s, "status/a.yml", "team: foo\npipeline: a\nbuild: \"3\"\nstate: READY\n"+
+			"failure: {job: deploy, build: \"3\"}\n")
+
+		summary, err := d.Summary()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summary.State).To(Equal(models.StateFailed))
+		Expect(d.Ready()).To(BeTrue())
+
+		store(s, "status/b.yml", "team: foo\npipeline: b\nbuild: \"4\"\nstate: RUNNING\n")
+		Expect(d.Ready()).To(BeFalse())
+	})
+
+	It("summarizes every key under a prefix", func() {
+		store(s, "status/a.svg", "<svg/>")
+		store(s, "status/a.yml.lock/9", "build: {team: foo, pipeline: other}\n")
+		d.Keys = nil
+		d.Prefix = "status/"
+
+		summary, err := d.Summary()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summary.Pipelines).To(HaveLen(2))
+	})
+
+	It("starts every key", func() {
+		status, err := d.Start()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.State).To(Equal(models.StateRunning))
+		Expect(status.BuildNumber).To(Equal("9"))
+		Expect(read(s, "status/a.yml")).To(ContainSubstring("state: RUNNING"))
+		Expect(read(s, "status/b.yml")).To(ContainSubstring("state: RUNNING"))
+	})
+
+	It("starts no key when one of them cannot be started", func() {
+		store(s, "status/b.yml", "team: foo\npipeline: b\nbuild: \"4\"\nstate: RUNNING\n")
+
+		_, err := d.Start()
+		Expect(err).To(MatchError(ContainSubstring("Cannot start status/b.yml, none of the keys were changed: it is already RUNNING")))
+		Expect(read(s, "status/a.yml")).To(ContainSubstring("state: READY"))
+		Expect(read(s, "status/a.yml")).To(ContainSubstring(`build: "3"`))
+	})
+
+	It("removes statuses it created when a later key cannot be started", func() {
+		s.DeleteObject(&s3.DeleteObjectInput{Key: aws.String("status/a.yml")})
+		store(s, "status/b.yml", "team: foo\npipeline: b\nbuild: \"4\"\nstate: RUNNING\n")
+
+		_, err := d.Start()
+		Expect(err).To(HaveOccurred())
+		Expect(read(s, "status/a.yml")).To(BeEmpty())
+	})
+
+	It("reports the keys it cannot restore", func() {
+		s.DeleteObject(&s3.DeleteObjectInput{Key: aws.String("status/a.yml")})
+		store(s, "status/b.yml", "team: foo\npipeline: b\nbuild: \"4\"\nstate: RUNNING\n")
+		d.Base.Svc = &failingDeletes{s}
+
+		_, err := d.Start()
+		Expect(err).To(MatchError(HaveSuffix("and these keys were left changed: status/a.yml (access denied)")))
+	})
+
+	Context("while another build changes the keys", func() {
+		claim := func(seen time.Time) {
+			store(s, "status/b.yml.lock/41", fmt.Sprintf("build: {team: foo, pipeline: other, job: deploy, build: \"1\"}\n"+
+				"enqueued: %[1]s\nseen: %[1]s\n", seen.Format(models.ISO8601DateFormat)))
+		}
+
+		claims := func() []string {
+			out, err := s.ListObjectsV2(&s3.ListObjectsV2Input{Prefix: aws.String("status/")})
+			Expect(err).NotTo(HaveOccurred())
+
+			keys := []string{}
+			for _, object := range out.Contents {
+				if driver.IsLockKey(*object.Key) {
+					keys = append(keys, *object.Key)
+				}
+			}
+			return keys
+		}
+
+		It("changes none of them", func() {
+			claim(time.Now())
+
+			_, err := d.Start()
+			Expect(err).To(MatchError("Cannot start status/b.yml, foo/other/deploy #1 is changing it"))
+			Expect(read(s, "status/a.yml")).To(ContainSubstring("state: READY"))
+			Expect(claims()).To(Equal([]string{"status/b.yml.lock/41"}))
+		})
+
+		It("ignores claims that have gone stale", func() {
+			claim(time.Now().Add(-10 * time.Minute))
+
+			_, err := d.Start()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(read(s, "status/a.yml")).To(ContainSubstring("state: RUNNING"))
+			Expect(claims()).To(Equal([]string{"status/b.yml.lock/41"}))
+		})
+	})
+
+	It("refuses to queue", func() {
+		_, err := d.Enqueue(time.Time{}, 0)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+// failingDeletes refuses to remove statuses.
+type failingDeletes struct {
+	*driver.MemoryServicer
+}
+
+func (f *failingDeletes) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	if !driver.IsLockKey(*input.Key) {
+		return nil, fmt.Errorf("access denied")
+	}
+
+	return f.MemoryServicer.DeleteObject(input)
+}
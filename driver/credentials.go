@@ -0,0 +1,259 @@
+package driver
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go/aws/credentials/endpointcreds"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+)
+
+const (
+	defaultSessionName = "pipeline-status-resource"
+
+	metadataEndpoint  = "http://169.254.169.254"
+	containerEndpoint = "http://169.254.170.2"
+
+	// credentialsExpiryWindow refreshes temporary credentials this long
+	// before they expire, so a long require_ready wait does not run into an
+	// expired token.
+	credentialsExpiryWindow = 5 * time.Minute
+)
+
+// NewCredentials returns the credentials selected by the source's
+// credential_provider, assuming assume_role_arn with them when it is set.
+// Without a credential_provider the access keys are used when they are set,
+// and requests are anonymous otherwise.
+func NewCredentials(source models.Source, region string) (*credentials.Credentials, error) {
+	if source.AssumeRoleARN == "" && source.AssumeRoleExternalID != "" {
+		return nil, fmt.Errorf("assume_role_external_id needs assume_role_arn")
+	}
+	if source.AssumeRoleARN == "" && source.AssumeRoleSessionName != "" &&
+		source.CredentialProvider != models.CredentialsWebIdentity {
+		return nil, fmt.Errorf("assume_role_session_name needs assume_role_arn or the web_identity credential_provider")
+	}
+
+	creds, err := baseCredentials(source, region)
+	if err != nil {
+		return nil, err
+	}
+
+	if source.AssumeRoleARN == "" {
+		return creds, nil
+	}
+
+	return stscreds.NewCredentials(stsSession(source, region, creds), source.AssumeRoleARN,
+		func(p *stscreds.AssumeRoleProvider) {
+			p.RoleSessionName = sessionName(source)
+			if source.AssumeRoleExternalID != "" {
+				p.ExternalID = aws.String(source.AssumeRoleExternalID)
+			}
+			p.ExpiryWindow = credentialsExpiryWindow
+		}), nil
+}
+
+func baseCredentials(source models.Source, region string) (*credentials.Credentials, error) {
+	static := source.AccessKeyID != "" || source.SecretAccessKey != ""
+	if static && source.CredentialProvider != models.CredentialsUnspecified &&
+		source.CredentialProvider != models.CredentialsStatic {
+		return nil, fmt.Errorf("access_key_id and secret_access_key cannot be combined with the %s credential_provider",
+			source.CredentialProvider)
+	}
+
+	switch source.CredentialProvider {
+	case models.CredentialsUnspecified, models.CredentialsStatic:
+		if !static && source.CredentialProvider == models.CredentialsUnspecified {
+			return credentials.AnonymousCredentials, nil
+		}
+		if source.AccessKeyID == "" || source.SecretAccessKey == "" {
+			return nil, fmt.Errorf("access_key_id and secret_access_key must be set together")
+		}
+		return credentials.NewStaticCredentials(source.AccessKeyID, source.SecretAccessKey, source.SessionToken), nil
+
+	case models.CredentialsAnonymous:
+		return credentials.AnonymousCredentials, nil
+
+	case models.CredentialsEnv:
+		return credentials.NewEnvCredentials(), nil
+
+	case models.CredentialsProfile:
+		return credentials.NewSharedCredentials(source.SharedCredentialsFile, source.Profile), nil
+
+	case models.CredentialsEC2:
+		return credentials.NewCredentials(ec2Provider(source)), nil
+
+	case models.CredentialsECS:
+		provider, err := ecsProvider(source)
+		if err != nil {
+			return nil, err
+		}
+		return credentials.NewCredentials(provider), nil
+
+	case models.CredentialsWebIdentity:
+		provider, err := newWebIdentityProvider(source, region)
+		if err != nil {
+			return nil, err
+		}
+		return credentials.NewCredentials(provider), nil
+
+	case models.CredentialsDefault:
+		// The same order as the AWS SDKs' default chain. Web identity and
+		// container credentials are only tried when they are configured.
+		providers := []credentials.Provider{
+			&credentials.EnvProvider{},
+			&credentials.SharedCredentialsProvider{Filename: source.SharedCredentialsFile, Profile: source.Profile},
+		}
+		if provider, err := newWebIdentityProvider(source, region); err == nil {
+			providers = append(providers, provider)
+		}
+		if provider, err := ecsProvider(source); err == nil {
+			providers = append(providers, provider)
+		}
+		providers = append(providers, ec2Provider(source))
+
+		return credentials.NewCredentials(&credentials.ChainProvider{
+			Providers:     providers,
+			VerboseErrors: true,
+		}), nil
+
+	default:
+		return nil, fmt.Errorf("unknown credential_provider %s, expected static, anonymous, env, profile, ec2, ecs, web_identity or default",
+			source.CredentialProvider)
+	}
+}
+
+// ec2Provider reads the credentials of the instance's role from the
+// instance metadata service.
+func ec2Provider(source models.Source) credentials.Provider {
+	endpoint := source.MetadataEndpoint
+	if endpoint == "" {
+		endpoint = metadataEndpoint
+	}
+
+	client := ec2metadata.New(session.New(), &aws.Config{
+		Endpoint: aws.String(strings.TrimSuffix(endpoint, "/") + "/latest"),
+	})
+
+	return &ec2rolecreds.EC2RoleProvider{Client: client, ExpiryWindow: credentialsExpiryWindow}
+}
+
+// ecsProvider reads the credentials of the task's role from the container
+// credentials endpoint ECS sets up.
+func ecsProvider(source models.Source) (credentials.Provider, error) {
+	endpoint := source.ContainerCredentialsEndpoint
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	}
+	if relative := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); endpoint == "" && relative != "" {
+		endpoint = containerEndpoint + relative
+	}
+	if endpoint == "" {
+		return nil, fmt.Errorf("the ecs credential_provider needs container_credentials_endpoint or $AWS_CONTAINER_CREDENTIALS_RELATIVE_URI")
+	}
+
+	def := defaults.Get()
+	return endpointcreds.NewProviderClient(*def.Config, def.Handlers, endpoint, func(p *endpointcreds.Provider) {
+		p.ExpiryWindow = credentialsExpiryWindow
+	}), nil
+}
+
+func newWebIdentityProvider(source models.Source, region string) (credentials.Provider, error) {
+	tokenFile := source.WebIdentityTokenFile
+	if tokenFile == "" {
+		tokenFile = os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	}
+
+	roleARN := source.WebIdentityRoleARN
+	if roleARN == "" {
+		roleARN = os.Getenv("AWS_ROLE_ARN")
+	}
+
+	if tokenFile == "" || roleARN == "" {
+		return nil, fmt.Errorf("the web_identity credential_provider needs web_identity_token_file and web_identity_role_arn, or $AWS_WEB_IDENTITY_TOKEN_FILE and $AWS_ROLE_ARN")
+	}
+
+	return &webIdentityProvider{
+		client:      sts.New(stsSession(source, region, credentials.AnonymousCredentials)),
+		roleARN:     roleARN,
+		sessionName: sessionName(source),
+		tokenFile:   tokenFile,
+	}, nil
+}
+
+// webIdentityAssumer is the part of the STS client used by
+// webIdentityProvider.
+type webIdentityAssumer interface {
+	AssumeRoleWithWebIdentity(*sts.AssumeRoleWithWebIdentityInput) (*sts.AssumeRoleWithWebIdentityOutput, error)
+}
+
+// webIdentityProvider trades a web identity token, such as a Kubernetes
+// service account token, for the credentials of a role. The token file is
+// read on every refresh because it is rotated.
+type webIdentityProvider struct {
+	credentials.Expiry
+
+	client      webIdentityAssumer
+	roleARN     string
+	sessionName string
+	tokenFile   string
+}
+
+func (p *webIdentityProvider) Retrieve() (credentials.Value, error) {
+	token, err := ioutil.ReadFile(p.tokenFile)
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("Cannot read web identity token: %s", err)
+	}
+
+	output, err := p.client.AssumeRoleWithWebIdentity(&sts.AssumeRoleWithWebIdentityInput{
+		RoleArn:          aws.String(p.roleARN),
+		RoleSessionName:  aws.String(p.sessionName),
+		WebIdentityToken: aws.String(strings.TrimSpace(string(token))),
+	})
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	p.SetExpiration(aws.TimeValue(output.Credentials.Expiration), credentialsExpiryWindow)
+
+	return credentials.Value{
+		AccessKeyID:     aws.StringValue(output.Credentials.AccessKeyId),
+		SecretAccessKey: aws.StringValue(output.Credentials.SecretAccessKey),
+		SessionToken:    aws.StringValue(output.Credentials.SessionToken),
+		ProviderName:    "WebIdentityProvider",
+	}, nil
+}
+
+// stsSession talks to STS with the given credentials. It does not use the
+// source's endpoint, which points at the S3 compatible store.
+func stsSession(source models.Source, region string, creds *credentials.Credentials) *session.Session {
+	config := &aws.Config{
+		Region:      aws.String(region),
+		Credentials: creds,
+		MaxRetries:  aws.Int(maxRetries),
+	}
+
+	if source.STSEndpoint != "" {
+		config.Endpoint = aws.String(source.STSEndpoint)
+	}
+
+	return session.New(config)
+}
+
+func sessionName(source models.Source) string {
+	if source.AssumeRoleSessionName != "" {
+		return source.AssumeRoleSessionName
+	}
+
+	return defaultSessionName
+}
@@ -0,0 +1,211 @@
+package driver_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotalservices/pipeline-status-resource/driver"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+)
+
+const stsResponse = `<%[1]sResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <%[1]sResult>
+    <Credentials>
+      <AccessKeyId>%[2]s</AccessKeyId>
+      <SecretAccessKey>assumed-secret</SecretAccessKey>
+      <SessionToken>assumed-token</SessionToken>
+      <Expiration>2030-01-01T00:00:00Z</Expiration>
+    </Credentials>
+  </%[1]sResult>
+  <ResponseMetadata><RequestId>c6104cbe-af31-11e0-8154-cbc7ccf896c7</RequestId></ResponseMetadata>
+</%[1]sResponse>`
+
+var _ = Describe("Credentials", func() {
+	var (
+		server   *httptest.Server
+		requests []*http.Request
+		tmpdir   string
+		savedEnv map[string]string
+	)
+
+	envVars := []string{"AWS_ACCESS_KEY_ID", "AWS_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY", "AWS_SECRET_KEY",
+		"AWS_SESSION_TOKEN", "AWS_PROFILE", "AWS_SHARED_CREDENTIALS_FILE", "AWS_WEB_IDENTITY_TOKEN_FILE",
+		"AWS_ROLE_ARN", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI"}
+
+	get := func(source models.Source) (credentials.Value, error) {
+		creds, err := driver.NewCredentials(source, "us-east-1")
+		Expect(err).NotTo(HaveOccurred())
+		return creds.Get()
+	}
+
+	BeforeEach(func() {
+		requests = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			requests = append(requests, r)
+
+			switch strings.TrimSuffix(r.URL.Path, "/") {
+			case "/latest/meta-data/iam/security-credentials":
+				fmt.Fprint(w, "ci-role")
+			case "/latest/meta-data/iam/security-credentials/ci-role":
+				fmt.Fprint(w, `{"Code": "Success", "Type": "AWS-HMAC", "AccessKeyId": "ec2-key",
+					"SecretAccessKey": "ec2-secret", "Token": "ec2-token", "Expiration": "2030-01-01T00:00:00Z"}`)
+			case "/ecs/credentials":
+				fmt.Fprint(w, `{"AccessKeyId": "ecs-key", "SecretAccessKey": "ecs-secret", "Token": "ecs-token",
+					"Expiration": "2030-01-01T00:00:00Z"}`)
+			case "/sts":
+				action := r.Form.Get("Action")
+				fmt.Fprintf(w, stsResponse, action, strings.ToLower(action)+"-key")
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+
+		var err error
+		tmpdir, err = ioutil.TempDir("", "credentials")
+		Expect(err).NotTo(HaveOccurred())
+
+		savedEnv = map[string]string{}
+		for _, name := range envVars {
+			savedEnv[name] = os.Getenv(name)
+			os.Unsetenv(name)
+		}
+		os.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(tmpdir, "missing"))
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(tmpdir)
+		for name, value := range savedEnv {
+			if value == "" {
+				os.Unsetenv(name)
+			} else {
+				os.Setenv(name, value)
+			}
+		}
+	})
+
+	It("is anonymous without keys", func() {
+		creds, err := driver.NewCredentials(models.Source{}, "us-east-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(creds).To(BeIdenticalTo(credentials.AnonymousCredentials))
+	})
+
+	It("uses the keys in the source", func() {
+		value, err := get(models.Source{AccessKeyID: "key", SecretAccessKey: "secret", SessionToken: "token"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value.AccessKeyID).To(Equal("key"))
+		Expect(value.SecretAccessKey).To(Equal("secret"))
+		Expect(value.SessionToken).To(Equal("token"))
+	})
+
+	It("validates the source up front", func() {
+		for source, message := range map[*models.Source]string{
+			{AccessKeyID: "key"}:                           "access_key_id and secret_access_key must be set together",
+			{CredentialProvider: models.CredentialsStatic}: "access_key_id and secret_access_key must be set together",
+			{CredentialProvider: models.CredentialsEC2, AccessKeyID: "key", SecretAccessKey: "secret"}: "access_key_id and secret_access_key cannot be combined with the ec2 credential_provider",
+			{CredentialProvider: "vault"}:                       "unknown credential_provider vault, expected static, anonymous, env, profile, ec2, ecs, web_identity or default",
+			{CredentialProvider: models.CredentialsECS}:         "the ecs credential_provider needs container_credentials_endpoint or $AWS_CONTAINER_CREDENTIALS_RELATIVE_URI",
+			{CredentialProvider: models.CredentialsWebIdentity}: "the web_identity credential_provider needs web_identity_token_file and web_identity_role_arn, or $AWS_WEB_IDENTITY_TOKEN_FILE and $AWS_ROLE_ARN",
+			{AssumeRoleExternalID: "tenant"}:                    "assume_role_external_id needs assume_role_arn",
+			{AssumeRoleSessionName: "deploy"}:                   "assume_role_session_name needs assume_role_arn or the web_identity credential_provider",
+		} {
+			_, err := driver.NewCredentials(*source, "us-east-1")
+			Expect(err).To(MatchError(message))
+
+			_, err = driver.FromSource(*source)
+			Expect(err).To(MatchError(message))
+		}
+	})
+
+	It("reads the environment", func() {
+		os.Setenv("AWS_ACCESS_KEY_ID", "env-key")
+		os.Setenv("AWS_SECRET_ACCESS_KEY", "env-secret")
+
+		value, err := get(models.Source{CredentialProvider: models.CredentialsEnv})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value.AccessKeyID).To(Equal("env-key"))
+	})
+
+	It("reads a profile of the shared credentials file", func() {
+		file := filepath.Join(tmpdir, "credentials")
+		Expect(ioutil.WriteFile(file, []byte("[default]\naws_access_key_id = default-key\naws_secret_access_key = default-secret\n\n"+
+			"[ci]\naws_access_key_id = ci-key\naws_secret_access_key = ci-secret\n"), 0600)).To(Succeed())
+
+		value, err := get(models.Source{CredentialProvider: models.CredentialsProfile, SharedCredentialsFile: file, Profile: "ci"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value.AccessKeyID).To(Equal("ci-key"))
+	})
+
+	It("reads the instance role from the metadata endpoint", func() {
+		value, err := get(models.Source{CredentialProvider: models.CredentialsEC2, MetadataEndpoint: server.URL})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value.AccessKeyID).To(Equal("ec2-key"))
+		Expect(value.SessionToken).To(Equal("ec2-token"))
+	})
+
+	It("reads the task role from the container credentials endpoint", func() {
+		value, err := get(models.Source{CredentialProvider: models.CredentialsECS, ContainerCredentialsEndpoint: server.URL + "/ecs/credentials"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value.AccessKeyID).To(Equal("ecs-key"))
+	})
+
+	It("trades a web identity token for a role", func() {
+		token := filepath.Join(tmpdir, "token")
+		Expect(ioutil.WriteFile(token, []byte("eyJhbGciOi.token\n"), 0600)).To(Succeed())
+
+		os.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", token)
+		os.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/ci")
+
+		value, err := get(models.Source{CredentialProvider: models.CredentialsWebIdentity, AssumeRoleSessionName: "deploy-pipeline",
+			STSEndpoint: server.URL + "/sts"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value.AccessKeyID).To(Equal("assumerolewithwebidentity-key"))
+
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Form.Get("WebIdentityToken")).To(Equal("eyJhbGciOi.token"))
+		Expect(requests[0].Form.Get("RoleArn")).To(Equal("arn:aws:iam::123456789012:role/ci"))
+		Expect(requests[0].Form.Get("RoleSessionName")).To(Equal("deploy-pipeline"))
+		Expect(requests[0].Header.Get("Authorization")).To(BeEmpty())
+	})
+
+	It("falls through the default chain to the instance role", func() {
+		value, err := get(models.Source{CredentialProvider: models.CredentialsDefault, MetadataEndpoint: server.URL})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value.AccessKeyID).To(Equal("ec2-key"))
+
+		os.Setenv("AWS_ACCESS_KEY_ID", "env-key")
+		os.Setenv("AWS_SECRET_ACCESS_KEY", "env-secret")
+		value, err = get(models.Source{CredentialProvider: models.CredentialsDefault, MetadataEndpoint: server.URL})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value.AccessKeyID).To(Equal("env-key"))
+	})
+
+	It("assumes a role with the selected credentials", func() {
+		value, err := get(models.Source{
+			AccessKeyID:           "base-key",
+			SecretAccessKey:       "base-secret",
+			AssumeRoleARN:         "arn:aws:iam::123456789012:role/deployer",
+			AssumeRoleExternalID:  "tenant-42",
+			AssumeRoleSessionName: "deploy-pipeline",
+			STSEndpoint:           server.URL + "/sts",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value.AccessKeyID).To(Equal("assumerole-key"))
+		Expect(value.SessionToken).To(Equal("assumed-token"))
+
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Form.Get("RoleArn")).To(Equal("arn:aws:iam::123456789012:role/deployer"))
+		Expect(requests[0].Form.Get("ExternalId")).To(Equal("tenant-42"))
+		Expect(requests[0].Form.Get("RoleSessionName")).To(Equal("deploy-pipeline"))
+		Expect(requests[0].Header.Get("Authorization")).To(ContainSubstring("Credential=base-key/"))
+	})
+})
@@ -0,0 +1,107 @@
+package driver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/state"
+)
+
+// DependencyResolver is implemented by drivers that know which statuses a
+// pipeline depends on.
+type DependencyResolver interface {
+	BlockingDependency() (chain []string, reason string, err error)
+}
+
+// DescribeBlockingDependency describes the chain of dependencies keeping the
+// pipeline from starting, or returns an empty string when nothing blocks it
+// or the driver does not track dependencies.
+func DescribeBlockingDependency(d Driver) (string, error) {
+	resolver, ok := d.(DependencyResolver)
+	if !ok {
+		return "", nil
+	}
+
+	chain, reason, err := resolver.BlockingDependency()
+	if err != nil || len(chain) == 0 {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s: %s", strings.Join(chain, " -> "), reason), nil
+}
+
+// BlockingDependency walks the statuses the pipeline depends on, and the
+// ones they recorded depending on when they last started, breadth first. It
+// returns the chain of keys leading to the first status that is running or
+// has a failure, and why it blocks. Statuses that were never stored do not
+// block.
+func (driver *S3Driver) BlockingDependency() (chain []string, reason string, err error) {
+	type step struct {
+		key   string
+		chain []string
+	}
+
+	visited := map[string]bool{}
+	if key, err := ExpandKey(driver.Key, driver.Env); err == nil {
+		visited[key] = true
+	}
+
+	keys, err := driver.expandedDependencies()
+	if err != nil {
+		return nil, "", err
+	}
+
+	steps := []step{}
+	for _, key := range keys {
+		steps = append(steps, step{key, []string{key}})
+	}
+
+	for len(steps) > 0 {
+		s := steps[0]
+		steps = steps[1:]
+
+		if visited[s.key] {
+			continue
+		}
+		visited[s.key] = true
+
+		d := *driver
+		d.Key = s.key
+
+		status := &models.PipelineStatus{}
+		ok, err := d.Load(status)
+		if !ok {
+			return nil, "", err
+		}
+		if err != nil {
+			continue
+		}
+
+		if reason, blocked := state.DependencyBlocked(status); blocked {
+			return s.chain, reason, nil
+		}
+
+		for _, next := range status.DependsOn {
+			chain := append(append([]string{}, s.chain...), next)
+			steps = append(steps, step{next, chain})
+		}
+	}
+
+	return nil, "", nil
+}
+
+// expandedDependencies returns the keys the pipeline depends on with their
+// placeholders filled, as recorded in its status.
+func (driver *S3Driver) expandedDependencies() ([]string, error) {
+	var keys []string
+	for _, key := range driver.DependsOn {
+		expanded, err := ExpandKey(key, driver.Env)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, expanded)
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,75 @@
+package driver_test
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotalservices/pipeline-status-resource/driver"
+)
+
+var _ = Describe("Dependencies", func() {
+	var (
+		s *driver.MemoryServicer
+		d *driver.S3Driver
+	)
+
+	BeforeEach(func() {
+		s = driver.NewMemoryServicer(map[string]string{
+			"a.yml": "team: foo\npipeline: a\nbuild: \"3\"\nstate: READY\ndepends_on: [c.yml]\n",
+			"c.yml": "team: foo\npipeline: c\nbuild: \"5\"\nstate: READY\ndepends_on: [b.yml]\n",
+		})
+		d = &driver.S3Driver{
+			Svc:       s,
+			Env:       mockEnv,
+			Key:       "b.yml",
+			DependsOn: []string{"a.yml", "missing.yml"},
+		}
+	})
+
+	It("starts when no dependency is running or failed", func() {
+		_, err := d.Start()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(read(s, "b.yml")).To(ContainSubstring("depends_on:\n- a.yml\n- missing.yml\n"))
+	})
+
+	It("refuses to start while a dependency is running", func() {
+		store(s, "a.yml", "team: foo\npipeline: a\nbuild: \"4\"\nstate: RUNNING\n")
+
+		_, err := d.Start()
+		Expect(err).To(MatchError("Cannot start pipeline bar, it depends on a.yml and pipeline a is running build 4"))
+		Expect(read(s, "b.yml")).To(BeEmpty())
+	})
+
+	It("reports the chain to a failed dependency of a dependency", func() {
+		store(s, "c.yml", "team: foo\npipeline: c\nbuild: \"5\"\nstate: READY\n"+
+			"failure: {job: deploy, build: \"5\", details: https://ci/5}\n")
+
+		chain, reason, err := d.BlockingDependency()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(chain).To(Equal([]string{"a.yml", "c.yml"}))
+		Expect(reason).To(Equal("pipeline c failed in job deploy build 5, see https://ci/5"))
+
+		_, err = d.Start()
+		Expect(err).To(MatchError(ContainSubstring("it depends on a.yml -> c.yml and pipeline c failed")))
+	})
+
+	It("describes the blocking chain", func() {
+		store(s, "c.yml", "team: foo\npipeline: c\nbuild: \"5\"\nstate: RUNNING\n")
+
+		blockedBy, err := driver.DescribeBlockingDependency(d)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(blockedBy).To(Equal("a.yml -> c.yml: pipeline c is running build 5"))
+
+		s.DeleteObject(&s3.DeleteObjectInput{Key: aws.String("c.yml")})
+		Expect(driver.DescribeBlockingDependency(d)).To(BeEmpty())
+	})
+
+	It("stops at cycles", func() {
+		store(s, "b.yml", "team: foo\npipeline: bar\nbuild: \"1\"\nstate: RUNNING\n")
+
+		chain, _, err := d.BlockingDependency()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(chain).To(BeEmpty())
+	})
+})
@@ -2,23 +2,41 @@ package driver
 
 import (
 	"fmt"
-	"os"
 	"strconv"
+	"time"
 
 	"github.com/adammck/venv"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pivotalservices/pipeline-status-resource/blackout"
+	"github.com/pivotalservices/pipeline-status-resource/clock"
+	"github.com/pivotalservices/pipeline-status-resource/logger"
 	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/notify"
+	"github.com/pivotalservices/pipeline-status-resource/redact"
+	"github.com/pivotalservices/pipeline-status-resource/schema"
+	"github.com/pivotalservices/pipeline-status-resource/state"
 )
 
 type Driver interface {
-	Check(lastModCursor string) ([]string, error)
+	Check(lastModCursor string) ([]models.Version, error)
 	Load(status *models.PipelineStatus) (bool, error)
 	Start() (*models.PipelineStatus, error)
-	Finish() (*models.PipelineStatus, error)
-	Fail() (*models.PipelineStatus, error)
+	Finish(force bool) (*models.PipelineStatus, error)
+	Fail(force bool) (*models.PipelineStatus, error)
+	SetState(state models.PipelineState) (*models.PipelineStatus, error)
+	Freeze(reason string, expires time.Time) (*models.PipelineStatus, error)
+	Unfreeze() (*models.PipelineStatus, error)
+	Enqueue(enqueued time.Time, priority int) (int, error)
+	ForceReady(reason string) (*models.PipelineStatus, error)
+}
+
+// EnvSetter is implemented by drivers that read the build metadata of the
+// build acting on the status from an environment, so that tools acting
+// outside of Concourse can give their own.
+type EnvSetter interface {
+	SetEnv(env venv.Env)
 }
 
 const maxRetries = 12
@@ -26,25 +44,101 @@ const maxRetries = 12
 func FromSource(source models.Source) (Driver, error) {
 	initialVersion := source.InitialVersion
 
-	switch source.Driver {
-	case models.DriverUnspecified, models.DriverS3:
-		var creds *credentials.Credentials
+	clk := clock.System()
+
+	log, err := logger.FromSource(source)
+	if err != nil {
+		return nil, err
+	}
+
+	machine, err := state.FromSource(source)
+	if err != nil {
+		return nil, err
+	}
+	machine.Clock = clk
+	machine.Log = log
+
+	blackouts, err := blackout.FromSource(source.BlackoutWindows)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregate := len(source.Keys) > 0 || source.KeyPrefix != ""
+	if aggregate && source.Key != "" {
+		return nil, fmt.Errorf("key cannot be combined with keys or key_prefix")
+	}
+	if aggregate && source.Queue {
+		return nil, fmt.Errorf("queue cannot be combined with keys or key_prefix")
+	}
+
+	if source.Badge {
+		for _, key := range append([]string{source.Key}, source.Keys...) {
+			if key != "" && BadgeKey(key) == key {
+				return nil, fmt.Errorf("key %s cannot be used with badge, the badge would be uploaded over the status", key)
+			}
+		}
+	}
+
+	keys := append([]string{source.Key, source.KeyPrefix}, source.Keys...)
+	for _, key := range append(keys, source.DependsOn...) {
+		if err = ValidateKey(key); err != nil {
+			return nil, err
+		}
+	}
+
+	hooks, err := notify.FromSource(source.Notifications)
+	if err != nil {
+		return nil, err
+	}
+
+	format, err := schema.ParseFormat(source.Format)
+	if err != nil {
+		return nil, err
+	}
 
-		if source.AccessKeyID == "" && source.SecretAccessKey == "" {
-			creds = credentials.AnonymousCredentials
-		} else {
-			creds = credentials.NewStaticCredentials(source.AccessKeyID, source.SecretAccessKey, "")
+	var queueTimeout time.Duration
+	if source.QueueTimeout != "" {
+		if queueTimeout, err = time.ParseDuration(source.QueueTimeout); err != nil {
+			return nil, fmt.Errorf("invalid queue_timeout: %s", err)
+		}
+	}
+	if source.Queue || source.QueueTimeout != "" {
+		// Waiting builds refresh their tickets once per poll, so a shorter
+		// timeout would drop them from the queue between polls.
+		timeout, retry := queueTimeout, RetryPeriod(source)
+		if timeout <= 0 {
+			timeout = models.DefaultQueueTimeout
 		}
+		if timeout <= retry {
+			return nil, fmt.Errorf("queue_timeout %s must be longer than retry_after %s", timeout, retry)
+		}
+	}
 
+	switch source.Driver {
+	case models.DriverUnspecified, models.DriverS3:
 		regionName := source.RegionName
 		if len(regionName) == 0 {
 			regionName = "us-east-1"
 		}
 
+		creds, err := NewCredentials(source, regionName)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = ValidateEncryption(source); err != nil {
+			return nil, err
+		}
+
+		customerKey, err := DecodeSSECustomerKey(source.SSECustomerKey)
+		if err != nil {
+			return nil, err
+		}
+
 		logLevel := aws.LogOff
 
 		if IsDebug(source) {
-			logLevel = aws.LogDebugWithSigning
+			logLevel = aws.LogDebug
 		}
 
 		awsConfig := &aws.Config{
@@ -55,7 +149,9 @@ func FromSource(source models.Source) (Driver, error) {
 			DisableSSL:       aws.Bool(source.DisableSSL),
 			LogLevel:         &logLevel,
 			Logger: aws.LoggerFunc(func(args ...interface{}) {
-				fmt.Fprintln(os.Stderr, args...)
+				// Request dumps carry signatures, session tokens and
+				// customer keys, none of which are in the source.
+				log.Debug("AWS request", "details", redact.Headers(fmt.Sprint(args...)))
 			}),
 		}
 
@@ -64,10 +160,13 @@ func FromSource(source models.Source) (Driver, error) {
 		}
 
 		svc := s3.New(session.New(awsConfig))
+		if len(source.SSEKMSEncryptionContext) > 0 {
+			svc.Handlers.Build.PushBack(EncryptionContextHandler(source.SSEKMSEncryptionContext))
+		}
 		if source.UseV2Signing {
 			setv2Handlers(svc)
 		}
-		return &S3Driver{
+		s3Driver := &S3Driver{
 			InitialVersion: initialVersion,
 
 			Env:                  venv.OS(),
@@ -75,7 +174,34 @@ func FromSource(source models.Source) (Driver, error) {
 			BucketName:           source.Bucket,
 			Key:                  source.Key,
 			ServerSideEncryption: source.ServerSideEncryption,
-		}, nil
+			SSEKMSKeyID:          source.SSEKMSKeyID,
+			SSECustomerKey:       customerKey,
+			Format:               format,
+			SharedLock:           source.SharedLock,
+			PipelineOwnership:    source.PipelineOwnership,
+			Slots:                source.Slots,
+			Queue:                source.Queue,
+			QueueTimeout:         queueTimeout,
+			AllowAdminActions:    source.AllowAdminActions,
+			DependsOn:            source.DependsOn,
+			Badge:                source.Badge,
+			BadgeACL:             source.BadgeACL,
+			Hooks:                hooks,
+			Machine:              machine,
+			Blackouts:            blackouts,
+			Clock:                clk,
+			Log:                  log,
+		}
+
+		if aggregate {
+			return &AggregateDriver{
+				Base:   *s3Driver,
+				Keys:   source.Keys,
+				Prefix: source.KeyPrefix,
+			}, nil
+		}
+
+		return s3Driver, nil
 
 		/*
 			THESE ARE CURRENTLY UNSUPPORTED
@@ -119,3 +245,13 @@ func IsDebug(source models.Source) bool {
 
 	return debug && (err == nil)
 }
+
+// RetryPeriod returns how long builds wait between polls of a status.
+func RetryPeriod(source models.Source) time.Duration {
+	retryDuration, err := time.ParseDuration(source.RetryAfter)
+	if err != nil {
+		return models.DefaultRetryPeriod
+	}
+
+	return retryDuration
+}
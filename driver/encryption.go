@@ -0,0 +1,135 @@
+package driver
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+)
+
+const (
+	sseKMS = "aws:kms"
+	sseS3  = "AES256"
+
+	// sseCustomerAlgorithm is the only algorithm S3 accepts for
+	// customer-provided keys.
+	sseCustomerAlgorithm = "AES256"
+
+	sseCustomerKeyLength = 32
+
+	// sseContextHeader carries the KMS encryption context, which the pinned
+	// SDK has no parameter for.
+	sseContextHeader = "X-Amz-Server-Side-Encryption-Context"
+)
+
+// ValidateEncryption reports combinations of the source's encryption options
+// that S3 would only reject once a status is read or stored.
+func ValidateEncryption(source models.Source) error {
+	kms := source.SSEKMSKeyID != "" || len(source.SSEKMSEncryptionContext) > 0
+	if kms && source.ServerSideEncryption != sseKMS {
+		return fmt.Errorf("sse_kms_key_id and sse_kms_encryption_context need server_side_encryption %s", sseKMS)
+	}
+
+	if source.SSECustomerKey == "" {
+		return nil
+	}
+
+	if source.ServerSideEncryption != "" {
+		return fmt.Errorf("sse_customer_key cannot be combined with server_side_encryption")
+	}
+	if source.DisableSSL {
+		return fmt.Errorf("sse_customer_key cannot be combined with disable_ssl, customer keys are only accepted over HTTPS")
+	}
+	if source.Badge {
+		return fmt.Errorf("sse_customer_key cannot be combined with badge, a badge encrypted with a customer key cannot be shown")
+	}
+
+	_, err := DecodeSSECustomerKey(source.SSECustomerKey)
+	return err
+}
+
+// DecodeSSECustomerKey decodes a base64 encoded 256-bit customer key, or
+// returns nil when none is set.
+func DecodeSSECustomerKey(encoded string) ([]byte, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != sseCustomerKeyLength {
+		return nil, fmt.Errorf("sse_customer_key must be a base64 encoded 256-bit key")
+	}
+
+	return key, nil
+}
+
+// EncryptionContextHandler returns a build handler passing the KMS encryption
+// context with every object stored or copied with aws:kms. S3 expects the
+// context as base64 encoded JSON.
+func EncryptionContextHandler(context map[string]string) func(*request.Request) {
+	data, _ := json.Marshal(context)
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	return func(r *request.Request) {
+		var sse *string
+		switch params := r.Params.(type) {
+		case *s3.PutObjectInput:
+			sse = params.ServerSideEncryption
+		case *s3.CopyObjectInput:
+			sse = params.ServerSideEncryption
+		}
+
+		if aws.StringValue(sse) == sseKMS {
+			r.HTTPRequest.Header.Set(sseContextHeader, encoded)
+		}
+	}
+}
+
+// encryptPut sets how an object the driver stores is encrypted at rest.
+func (driver *S3Driver) encryptPut(params *s3.PutObjectInput) {
+	if len(driver.ServerSideEncryption) > 0 {
+		params.ServerSideEncryption = aws.String(driver.ServerSideEncryption)
+	}
+
+	if len(driver.SSEKMSKeyID) > 0 {
+		params.SSEKMSKeyId = aws.String(driver.SSEKMSKeyID)
+	}
+
+	if len(driver.SSECustomerKey) > 0 {
+		params.SSECustomerAlgorithm, params.SSECustomerKey, params.SSECustomerKeyMD5 = driver.customerKey()
+	}
+}
+
+// encryptBadge sets how a badge is encrypted at rest. Badges are meant to be
+// fetched by anyone their ACL lets in, which a KMS key would refuse, so they
+// are encrypted with keys managed by S3 instead.
+func (driver *S3Driver) encryptBadge(params *s3.PutObjectInput) {
+	switch driver.ServerSideEncryption {
+	case "":
+	case sseKMS:
+		params.ServerSideEncryption = aws.String(sseS3)
+	default:
+		params.ServerSideEncryption = aws.String(driver.ServerSideEncryption)
+	}
+}
+
+// encryptGet passes the customer key an object was stored with, which S3
+// needs to read it back.
+func (driver *S3Driver) encryptGet(params *s3.GetObjectInput) {
+	if len(driver.SSECustomerKey) > 0 {
+		params.SSECustomerAlgorithm, params.SSECustomerKey, params.SSECustomerKeyMD5 = driver.customerKey()
+	}
+}
+
+// customerKey returns the SSE-C parameters. The SDK base64 encodes the raw
+// key itself.
+func (driver *S3Driver) customerKey() (algorithm *string, key *string, keyMD5 *string) {
+	sum := md5.Sum(driver.SSECustomerKey)
+	return aws.String(sseCustomerAlgorithm), aws.String(string(driver.SSECustomerKey)),
+		aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+}
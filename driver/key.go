@@ -0,0 +1,52 @@
+package driver
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/adammck/venv"
+)
+
+// keyVariables maps the placeholders allowed in a key template to the build
+// metadata variables they are filled from.
+var keyVariables = map[string]string{
+	"team":     "BUILD_TEAM_NAME",
+	"pipeline": "BUILD_PIPELINE_NAME",
+}
+
+var keyPlaceholder = regexp.MustCompile(`{{\s*([^{}\s]*)\s*}}`)
+
+// ValidateKey reports placeholders in a key template that cannot be filled.
+func ValidateKey(key string) error {
+	for _, match := range keyPlaceholder.FindAllStringSubmatch(key, -1) {
+		if _, ok := keyVariables[match[1]]; !ok {
+			return fmt.Errorf("Unknown placeholder %s in key %s, expected {{team}} or {{pipeline}}", match[0], key)
+		}
+	}
+
+	return nil
+}
+
+// ExpandKey fills the placeholders in a key template from the build metadata
+// in the environment. Keys without placeholders are returned unchanged.
+func ExpandKey(key string, env venv.Env) (string, error) {
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+
+	var err error
+	expanded := keyPlaceholder.ReplaceAllStringFunc(key, func(placeholder string) string {
+		name := keyPlaceholder.FindStringSubmatch(placeholder)[1]
+		value := env.Getenv(keyVariables[name])
+		if value == "" && err == nil {
+			err = fmt.Errorf("Cannot fill %s in key %s, %s is not set", placeholder, key, keyVariables[name])
+		}
+		return value
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return expanded, nil
+}
@@ -0,0 +1,81 @@
+package driver
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/state"
+)
+
+// lockSuffix follows a status key to form the prefix under which builds
+// changing it along with other keys claim it.
+const lockSuffix = ".lock/"
+
+// lockTimeout is how long the claim of a build that died while changing
+// several keys keeps other builds from changing them.
+const lockTimeout = 5 * time.Minute
+
+// LockPrefix returns the prefix under which builds changing the status
+// stored under the key along with other keys claim it, one object per build.
+func LockPrefix(key string) string {
+	return key + lockSuffix
+}
+
+// IsLockKey reports whether the key holds a claim rather than a status.
+func IsLockKey(key string) bool {
+	return strings.Contains(key, lockSuffix)
+}
+
+// claim stores a claim of the build on every key of the drivers, and then
+// makes sure no other build claims any of them, so that two builds never
+// change the same keys at once. S3 has no conditional writes, so like the
+// queue each build only writes claims of its own: of two builds claiming a
+// key at the same time at least one sees the other, and both back off when
+// they see each other. The returned func removes the claims.
+func (driver *AggregateDriver) claim(action models.StatusAction, drivers []*S3Driver) (func(), error) {
+	base := &driver.Base
+	deleter, ok := base.Svc.(Deleter)
+	if _, lists := base.Svc.(Lister); !ok || !lists {
+		return nil, fmt.Errorf("Cannot %s several keys, this driver cannot claim them", action)
+	}
+
+	me := base.buildIdentity()
+	claims := []string{}
+	release := func() {
+		for _, claimKey := range claims {
+			if err := base.removeTicket(deleter, claimKey); err != nil {
+				base.Log.Warn("Cannot remove claim, it keeps other builds out until it goes stale",
+					"key", claimKey, "error", err)
+			}
+		}
+	}
+
+	ticket := state.NewTicket(me, 0, base.now(), base.now())
+	for _, d := range drivers {
+		claimKey := LockPrefix(d.Key) + ticketName(me)
+		if err := base.storeTicket(claimKey, ticket); err != nil {
+			release()
+			return nil, err
+		}
+		claims = append(claims, claimKey)
+	}
+
+	for _, d := range drivers {
+		tickets, err := base.readTickets(LockPrefix(d.Key))
+		if err != nil {
+			release()
+			return nil, err
+		}
+
+		for _, other := range state.PruneQueue(tickets, lockTimeout, base.now()) {
+			if other.Build != me {
+				release()
+				return nil, fmt.Errorf("Cannot %s %s, %s is changing it", action, d.Key, state.DescribeBuild(other.Build))
+			}
+		}
+	}
+
+	return release, nil
+}
@@ -0,0 +1,105 @@
+package driver
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/notify"
+)
+
+// longLockSuffix follows a status key to name the object recording how long
+// its current run had held the lock when it was last checked.
+const longLockSuffix = ".long_lock"
+
+// longLockCheck is stored under the long lock key of a status.
+type longLockCheck struct {
+	RunStarted  string  `yaml:"run_started"`
+	HeldSeconds float64 `yaml:"held_seconds"`
+}
+
+// LongLockKey returns the key recording how long the current run of the
+// status stored under the key had held the lock when it was last checked.
+func LongLockKey(key string) string {
+	return key + longLockSuffix
+}
+
+// IsLongLockKey reports whether the key records a long lock check rather
+// than a status.
+func IsLongLockKey(key string) bool {
+	return strings.HasSuffix(key, longLockSuffix)
+}
+
+// checkLongLock tells the hooks how long the running status has held the
+// lock, and how long it had held it when last checked, so each hook sends
+// its long lock event once per run. check calls it on every poll, and only
+// reports failures as it has no status to change.
+func (driver *S3Driver) checkLongLock(key string, status *models.PipelineStatus) {
+	if len(driver.Hooks) == 0 || status.State != models.StateRunning || status.Stats == nil {
+		return
+	}
+
+	started, err := time.Parse(models.ISO8601DateFormat, status.Stats.RunStarted)
+	if err != nil {
+		return
+	}
+	held := driver.now().Sub(started)
+
+	last := longLockCheck{}
+	params := &s3.GetObjectInput{
+		Bucket: aws.String(driver.BucketName),
+		Key:    aws.String(LongLockKey(key)),
+	}
+	driver.encryptGet(params)
+
+	resp, err := driver.Svc.GetObject(params)
+	if err == nil {
+		data, readErr := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if readErr == nil {
+			err = yaml.Unmarshal(data, &last)
+		} else {
+			err = readErr
+		}
+	}
+	if err != nil && !isNotFound(err) {
+		driver.Log.Warn("Cannot read the last long lock check", "key", LongLockKey(key), "error", err)
+		return
+	}
+
+	heldBefore := time.Duration(0)
+	if last.RunStarted == status.Stats.RunStarted {
+		heldBefore = time.Duration(last.HeldSeconds * float64(time.Second))
+	}
+
+	// The check is stored first, so a failure to store it cannot make the
+	// hooks send the same event again on the next poll.
+	data, err := yaml.Marshal(longLockCheck{RunStarted: status.Stats.RunStarted, HeldSeconds: held.Seconds()})
+	if err != nil {
+		return
+	}
+
+	put := &s3.PutObjectInput{
+		Bucket:      aws.String(driver.BucketName),
+		Key:         aws.String(LongLockKey(key)),
+		ContentType: aws.String("application/x-yaml"),
+		Body:        bytes.NewReader(data),
+		ACL:         aws.String(s3.ObjectCannedACLPrivate),
+	}
+	driver.encryptPut(put)
+
+	done := driver.Log.Timed("Stored long lock check", "bucket", driver.BucketName, "key", LongLockKey(key))
+	_, err = driver.Svc.PutObject(put)
+	done(err)
+	if err != nil {
+		return
+	}
+
+	notify.NotifyAll(driver.Hooks, notify.NewLongLockEvent(key, status, held, heldBefore), driver.Log)
+}
@@ -0,0 +1,111 @@
+package driver
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// MemoryServicer keeps objects in memory in place of a bucket. It is meant
+// for tests and local experiments, and is safe for concurrent use.
+type MemoryServicer struct {
+	mutex   sync.Mutex
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	body         []byte
+	contentType  string
+	cacheControl string
+	lastModified time.Time
+}
+
+// NewMemoryServicer returns a servicer holding the given objects, keyed by
+// their keys.
+func NewMemoryServicer(objects map[string]string) *MemoryServicer {
+	m := &MemoryServicer{objects: map[string]memoryObject{}}
+	for key, body := range objects {
+		m.objects[key] = memoryObject{body: []byte(body), lastModified: time.Now()}
+	}
+
+	return m
+}
+
+func (m *MemoryServicer) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	object, ok := m.objects[aws.StringValue(input.Key)]
+	if !ok {
+		return nil, awserr.NewRequestFailure(awserr.New("NoSuchKey", "The specified key does not exist.", nil), 404, "")
+	}
+
+	return &s3.GetObjectOutput{
+		Body:         ioutil.NopCloser(bytes.NewReader(object.body)),
+		CacheControl: aws.String(object.cacheControl),
+		ContentType:  aws.String(object.contentType),
+		ETag:         aws.String(fmt.Sprintf("\"%x\"", md5.Sum(object.body))),
+		LastModified: aws.Time(object.lastModified),
+	}, nil
+}
+
+func (m *MemoryServicer) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	body, err := ioutil.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.objects[aws.StringValue(input.Key)] = memoryObject{
+		body:         body,
+		contentType:  aws.StringValue(input.ContentType),
+		cacheControl: aws.StringValue(input.CacheControl),
+		lastModified: time.Now(),
+	}
+
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (m *MemoryServicer) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.objects, aws.StringValue(input.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (m *MemoryServicer) ListObjectsV2(input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	keys := []string{}
+	for key := range m.objects {
+		if strings.HasPrefix(key, aws.StringValue(input.Prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	output := &s3.ListObjectsV2Output{IsTruncated: aws.Bool(false)}
+	for _, key := range keys {
+		object := m.objects[key]
+		output.Contents = append(output.Contents, &s3.Object{
+			Key:          aws.String(key),
+			LastModified: aws.Time(object.lastModified),
+			Size:         aws.Int64(int64(len(object.body))),
+		})
+	}
+
+	return output, nil
+}
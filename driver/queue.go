@@ -0,0 +1,230 @@
+package driver
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/state"
+)
+
+// queueSuffix follows a status key to form the prefix its tickets are
+// stored under.
+const queueSuffix = ".queue/"
+
+// Queuer is implemented by drivers that keep builds waiting to start in a
+// queue.
+type Queuer interface {
+	Tickets() ([]models.QueueTicket, error)
+}
+
+// Waiter is implemented by drivers that record how long builds waited to
+// start.
+type Waiter interface {
+	SetWaitStart(since time.Time)
+}
+
+// QueuePrefix returns the prefix under which the tickets of builds waiting
+// to start the status stored under the key are kept, one object per build.
+func QueuePrefix(key string) string {
+	return key + queueSuffix
+}
+
+// IsTicketKey reports whether the key holds a queue ticket rather than a
+// status.
+func IsTicketKey(key string) bool {
+	return strings.Contains(key, queueSuffix)
+}
+
+// Enqueue stores or refreshes the build's ticket, and returns how many
+// builds must start before it. Each build only ever writes its own ticket,
+// so waiting never rewrites the status a concurrent start or finish may be
+// changing.
+func (driver *S3Driver) Enqueue(enqueued time.Time, priority int) (ahead int, err error) {
+	if _, ok := driver.Svc.(Lister); !ok {
+		return 0, fmt.Errorf("queue and priority are not supported by this driver")
+	}
+
+	key, err := ExpandKey(driver.Key, driver.Env)
+	if err != nil {
+		return 0, err
+	}
+
+	me := driver.buildIdentity()
+	ticket := state.NewTicket(me, priority, enqueued, driver.now())
+	if err = driver.storeTicket(QueuePrefix(key)+ticketName(me), ticket); err != nil {
+		return 0, err
+	}
+
+	tickets, err := driver.Tickets()
+	if err != nil {
+		return 0, err
+	}
+
+	return driver.waitersAhead(tickets, me), nil
+}
+
+// SetWaitStart sets when the build started waiting to start, which Start
+// records as its lock wait.
+func (driver *S3Driver) SetWaitStart(since time.Time) {
+	driver.WaitStart = since
+}
+
+// Tickets returns the tickets of the builds waiting to start that have been
+// seen within the queue timeout, in the order they may start.
+func (driver *S3Driver) Tickets() ([]models.QueueTicket, error) {
+	if _, ok := driver.Svc.(Lister); !ok {
+		return nil, nil
+	}
+
+	key, err := ExpandKey(driver.Key, driver.Env)
+	if err != nil {
+		return nil, err
+	}
+
+	tickets, err := driver.readTickets(QueuePrefix(key))
+	if err != nil {
+		return nil, err
+	}
+
+	return state.PruneQueue(tickets, driver.queueTimeout(), driver.now()), nil
+}
+
+// storeTicket stores the ticket under the key.
+func (driver *S3Driver) storeTicket(ticketKey string, ticket models.QueueTicket) error {
+	data, err := yaml.Marshal(ticket)
+	if err != nil {
+		return err
+	}
+
+	params := &s3.PutObjectInput{
+		Bucket:      aws.String(driver.BucketName),
+		Key:         aws.String(ticketKey),
+		ContentType: aws.String("application/x-yaml"),
+		Body:        bytes.NewReader(data),
+		ACL:         aws.String(s3.ObjectCannedACLPrivate),
+	}
+	driver.encryptPut(params)
+
+	done := driver.Log.Timed("Stored ticket", "bucket", driver.BucketName, "key", ticketKey)
+	_, err = driver.Svc.PutObject(params)
+	done(err)
+	return err
+}
+
+// readTickets returns every ticket stored under the prefix.
+func (driver *S3Driver) readTickets(prefix string) ([]models.QueueTicket, error) {
+	keys, err := driver.listKeys(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	tickets := []models.QueueTicket{}
+	for _, ticketKey := range keys {
+		params := &s3.GetObjectInput{
+			Bucket: aws.String(driver.BucketName),
+			Key:    aws.String(ticketKey),
+		}
+		driver.encryptGet(params)
+
+		resp, err := driver.Svc.GetObject(params)
+		if isNotFound(err) {
+			// The build started or left between listing and reading.
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		ticket := models.QueueTicket{}
+		if err = yaml.Unmarshal(data, &ticket); err != nil {
+			return nil, fmt.Errorf("Cannot read ticket %s: %s", ticketKey, err)
+		}
+		tickets = append(tickets, ticket)
+	}
+
+	return tickets, nil
+}
+
+// leaveQueue removes the build's ticket once it has started. Tickets that
+// cannot be removed are dropped once they go stale, so failing is only
+// reported.
+func (driver *S3Driver) leaveQueue(tickets []models.QueueTicket, build models.BuildIdentity) {
+	deleter, ok := driver.Svc.(Deleter)
+	if !ok || state.QueuePosition(tickets, build) == len(tickets) {
+		return
+	}
+
+	key, err := ExpandKey(driver.Key, driver.Env)
+	if err != nil {
+		return
+	}
+
+	driver.removeTicket(deleter, QueuePrefix(key)+ticketName(build))
+}
+
+// removeTicket removes the ticket stored under the key.
+func (driver *S3Driver) removeTicket(deleter Deleter, ticketKey string) error {
+	done := driver.Log.Timed("Removed ticket", "bucket", driver.BucketName, "key", ticketKey)
+	_, err := deleter.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(driver.BucketName),
+		Key:    aws.String(ticketKey),
+	})
+	done(err)
+	return err
+}
+
+// listKeys returns every key under the prefix.
+func (driver *S3Driver) listKeys(prefix string) ([]string, error) {
+	lister, ok := driver.Svc.(Lister)
+	if !ok {
+		return nil, fmt.Errorf("listing keys is not supported by this driver")
+	}
+
+	keys := []string{}
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(driver.BucketName),
+		Prefix: aws.String(prefix),
+	}
+
+	for {
+		done := driver.Log.Timed("Listed keys", "bucket", driver.BucketName, "prefix", prefix)
+		output, err := lister.ListObjectsV2(input)
+		done(err)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range output.Contents {
+			keys = append(keys, aws.StringValue(object.Key))
+		}
+
+		if !aws.BoolValue(output.IsTruncated) {
+			return keys, nil
+		}
+		input.ContinuationToken = output.NextContinuationToken
+	}
+}
+
+// ticketName names a build's ticket after its Concourse build ID, or after
+// the rest of its identity outside of Concourse.
+func ticketName(build models.BuildIdentity) string {
+	if build.ID != "" {
+		return build.ID
+	}
+
+	return url.PathEscape(strings.Join([]string{build.Team, build.Pipeline, build.Job, build.Build}, "/"))
+}
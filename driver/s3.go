@@ -4,17 +4,22 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
-	"os"
+	"path"
 	"strconv"
 	"strings"
-
-	"gopkg.in/yaml.v2"
+	"time"
 
 	"github.com/adammck/venv"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pivotalservices/pipeline-status-resource/badge"
+	"github.com/pivotalservices/pipeline-status-resource/blackout"
+	"github.com/pivotalservices/pipeline-status-resource/clock"
+	"github.com/pivotalservices/pipeline-status-resource/logger"
 	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/notify"
+	"github.com/pivotalservices/pipeline-status-resource/schema"
 	"github.com/pivotalservices/pipeline-status-resource/state"
 )
 
@@ -30,6 +35,24 @@ type S3Driver struct {
 	BucketName           string
 	Key                  string
 	ServerSideEncryption string
+	SSEKMSKeyID          string
+	SSECustomerKey       []byte
+	Format               schema.Format
+	SharedLock           bool
+	PipelineOwnership    bool
+	Slots                int
+	Queue                bool
+	QueueTimeout         time.Duration
+	WaitStart            time.Time
+	AllowAdminActions    bool
+	DependsOn            []string
+	Badge                bool
+	BadgeACL             string
+	Hooks                []notify.Hook
+	Machine              *state.Machine
+	Blackouts            *blackout.Schedule
+	Clock                clock.Clock
+	Log                  *logger.Logger
 }
 
 func (driver *S3Driver) Start() (status *models.PipelineStatus, err error) {
@@ -39,15 +62,20 @@ func (driver *S3Driver) Start() (status *models.PipelineStatus, err error) {
 	status = &models.PipelineStatus{}
 	_, err = driver.Load(status)
 	if err == nil {
-		if status.Pipeline != pipelineName {
-			return status, fmt.Errorf("State file is already associated with pipeline %s but is trying to be associated with pipeline %s",
+		if status.Pipeline != pipelineName && !driver.SharedLock {
+			return status, fmt.Errorf("State file is already associated with pipeline %s but is trying to be associated with pipeline %s, set shared_lock to share it",
 				status.Pipeline, pipelineName)
 		}
 
-		if status.Team != teamName {
-			return status, fmt.Errorf("State file is already associated with team %s but is trying to be associated with tea, %s",
+		if status.Team != teamName && !driver.SharedLock {
+			return status, fmt.Errorf("State file is already associated with team %s but is trying to be associated with team %s, set shared_lock to share it",
 				status.Team, teamName)
 		}
+
+		if state.IsFrozen(status, driver.now()) {
+			return status, fmt.Errorf("Cannot start pipeline %s, it is %s",
+				status.Pipeline, state.DescribeFreeze(status.Freeze))
+		}
 	} else if s3err, ok := err.(awserr.RequestFailure); ok && s3err.StatusCode() == 404 {
 		status = &models.PipelineStatus{}
 		status.Pipeline = pipelineName
@@ -57,38 +85,190 @@ func (driver *S3Driver) Start() (status *models.PipelineStatus, err error) {
 		return nil, err
 	}
 
+	if chain, reason, err := driver.BlockingDependency(); err != nil {
+		return status, err
+	} else if len(chain) > 0 {
+		return status, fmt.Errorf("Cannot start pipeline %s, it depends on %s and %s",
+			pipelineName, strings.Join(chain, " -> "), reason)
+	}
+
+	if status.DependsOn, err = driver.expandedDependencies(); err != nil {
+		return status, err
+	}
+
+	if window, ends, active := driver.Blackouts.Active(driver.now()); active {
+		return status, fmt.Errorf("Cannot start pipeline %s during %s, it ends at %s",
+			pipelineName, window.Describe(), ends.Format(models.ISO8601DateFormat))
+	}
+
+	me := driver.buildIdentity()
+	tickets, err := driver.Tickets()
+	if err != nil {
+		return status, err
+	}
+	if ahead := driver.waitersAhead(tickets, me); ahead > 0 {
+		return status, fmt.Errorf("Cannot start pipeline %s, %d builds are queued ahead of %s",
+			pipelineName, ahead, state.DescribeBuild(me))
+	}
+	status = state.RecordLockWait(status, driver.WaitStart, driver.now())
+
+	if driver.Slots > 0 {
+		newStatus, err := driver.machine().Acquire(status, me, driver.Slots)
+		if err != nil {
+			return status, err
+		}
+
+		if err = driver.persistChange(status, newStatus); err != nil {
+			return newStatus, err
+		}
+
+		driver.leaveQueue(tickets, me)
+		return newStatus, nil
+	}
+
+	if status.State != models.StateRunning {
+		status.Holder = &me
+	}
+
 	_, err = driver.changeAndPersistState(status, models.StateRunning, nil)
 	if err != nil {
 		return status, err
 	}
 
+	driver.leaveQueue(tickets, me)
 	return
 }
 
-func (driver *S3Driver) Finish() (status *models.PipelineStatus, err error) {
-	return driver.makeReady(nil)
+func (driver *S3Driver) Finish(force bool) (status *models.PipelineStatus, err error) {
+	return driver.makeReady(nil, force)
 }
 
-func (driver *S3Driver) Fail() (status *models.PipelineStatus, err error) {
+func (driver *S3Driver) Fail(force bool) (status *models.PipelineStatus, err error) {
 	failure := &models.BuildFailure{}
 
-	failure.JobName = os.Getenv("BUILD_JOB_NAME")
-	failure.BuildName = os.Getenv("BUILD_NAME")
+	failure.JobName = driver.Env.Getenv("BUILD_JOB_NAME")
+	failure.BuildName = driver.Env.Getenv("BUILD_NAME")
 	failure.DetailsURL = fmt.Sprintf("%s/teams/%s/pipelines/%s/jobs/%s/builds/%s",
-		os.Getenv("ATC_EXTERNAL_URL"),
-		os.Getenv("BUILD_TEAM_NAME"),
-		os.Getenv("BUILD_PIPELINE_NAME"),
-		os.Getenv("BUILD_JOB_NAME"),
-		os.Getenv("BUILD_NAME"))
+		driver.Env.Getenv("ATC_EXTERNAL_URL"),
+		driver.Env.Getenv("BUILD_TEAM_NAME"),
+		driver.Env.Getenv("BUILD_PIPELINE_NAME"),
+		driver.Env.Getenv("BUILD_JOB_NAME"),
+		driver.Env.Getenv("BUILD_NAME"))
+
+	return driver.makeReady(failure, force)
+}
+
+func (driver *S3Driver) SetState(pipelineState models.PipelineState) (status *models.PipelineStatus, err error) {
+	status = &models.PipelineStatus{}
+	ok, err := driver.Load(status)
+	if !ok {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("Cannot set the state of a pipeline status that does not exist yet")
+	}
+
+	// The lock is only taken and released by the actions that check who
+	// holds it.
+	if pipelineState == models.StateRunning && status.State != models.StateRunning {
+		return nil, fmt.Errorf("Cannot set the state of pipeline %s to %s, use the %s action",
+			status.Pipeline, models.StateRunning, models.Start)
+	}
+	if status.State == models.StateRunning && pipelineState != models.StateRunning {
+		return nil, fmt.Errorf("Cannot set the state of pipeline %s while it is %s, use the %s or %s action, or %s",
+			status.Pipeline, models.StateRunning, models.Finish, models.Fail, models.ForceReady)
+	}
+
+	if _, err = driver.changeAndPersistState(status, pipelineState, status.Failure); err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+func (driver *S3Driver) Freeze(reason string, expires time.Time) (status *models.PipelineStatus, err error) {
+	status = &models.PipelineStatus{}
+	ok, err := driver.Load(status)
+	if !ok {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("Cannot freeze a pipeline status that does not exist yet")
+	}
+
+	status = state.Freeze(status, driver.buildIdentity(), reason, expires, driver.now())
+	if err = driver.persist(status); err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+func (driver *S3Driver) Unfreeze() (status *models.PipelineStatus, err error) {
+	status = &models.PipelineStatus{}
+	ok, err := driver.Load(status)
+	if !ok {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("Cannot unfreeze a pipeline status that does not exist yet")
+	}
+
+	if status.Freeze == nil {
+		return status, nil
+	}
+
+	status = state.Unfreeze(status, driver.now())
+	if err = driver.persist(status); err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+func (driver *S3Driver) ForceReady(reason string) (status *models.PipelineStatus, err error) {
+	if !driver.AllowAdminActions {
+		return nil, fmt.Errorf("The %s action requires allow_admin_actions to be set on the source", models.ForceReady)
+	}
+
+	if reason == "" {
+		return nil, fmt.Errorf("The %s action requires a reason", models.ForceReady)
+	}
+
+	status = &models.PipelineStatus{}
+	ok, err := driver.Load(status)
+	if !ok {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("Cannot reset a pipeline status that does not exist yet")
+	}
+
+	me := driver.buildIdentity()
+	driver.Log.Warn("Forcing pipeline ready", "pipeline", status.Pipeline, "from", status.State,
+		"to", models.StateReady, "by", state.DescribeBuild(me), "reason", reason)
+
+	previous := status
+	status = state.ForceReady(status, me, reason, driver.now())
+	if err = driver.persistChange(previous, status); err != nil {
+		return nil, err
+	}
 
-	return driver.makeReady(failure)
+	return status, nil
 }
 
-func (driver *S3Driver) Check(cursor string) ([]string, error) {
+func (driver *S3Driver) Check(cursor string) ([]models.Version, error) {
+	if err := ValidateKey(driver.Key); err != nil {
+		return nil, err
+	}
+	key, err := ExpandKey(driver.Key, driver.Env)
+	if err != nil {
+		// Concourse does not pass build metadata to check, so a templated
+		// key has no status to report. get and put still fill it in.
+		driver.Log.Info("Reporting no versions for templated key", "key", driver.Key, "reason", err)
+		return []models.Version{}, nil
+	}
+
 	status := &models.PipelineStatus{}
 	ok, err := driver.Load(status)
 
-	versions := make([]string, 0, 1)
+	versions := make([]models.Version, 0, 1)
 
 	if ok {
 		err = nil
@@ -96,26 +276,42 @@ func (driver *S3Driver) Check(cursor string) ([]string, error) {
 		case "":
 			if cursor == "" {
 				if driver.InitialVersion != "" {
-					versions = append(versions, driver.InitialVersion)
+					versions = append(versions, models.Version{Number: driver.InitialVersion})
 				} else {
-					versions = append(versions, "1")
+					versions = append(versions, models.Version{Number: "1"})
 				}
 			}
 		default:
 			if strings.Compare(status.BuildNumber, cursor) >= 0 {
-				versions = append(versions, status.BuildNumber)
+				versions = append(versions, models.Version{Number: status.BuildNumber})
 			}
 		}
+
+		driver.checkLongLock(key, status)
 	}
 
 	return versions, err
 }
 
 func (driver *S3Driver) Load(status *models.PipelineStatus) (bool, error) {
-	resp, err := driver.Svc.GetObject(&s3.GetObjectInput{
+	key, err := ExpandKey(driver.Key, driver.Env)
+	if err != nil {
+		return false, err
+	}
+
+	params := &s3.GetObjectInput{
 		Bucket: aws.String(driver.BucketName),
-		Key:    aws.String(driver.Key),
-	})
+		Key:    aws.String(key),
+	}
+	driver.encryptGet(params)
+
+	done := driver.Log.Timed("Loaded status", "bucket", driver.BucketName, "key", key)
+	resp, err := driver.Svc.GetObject(params)
+	if isNotFound(err) {
+		done(nil)
+	} else {
+		done(err)
+	}
 
 	if resp != nil && err == nil {
 		var statusYaml []byte
@@ -126,7 +322,7 @@ func (driver *S3Driver) Load(status *models.PipelineStatus) (bool, error) {
 
 		defer resp.Body.Close()
 
-		err = yaml.Unmarshal(statusYaml, status)
+		err = schema.Decode(statusYaml, status)
 		if err != nil {
 			return false, err
 		}
@@ -139,7 +335,7 @@ func (driver *S3Driver) Load(status *models.PipelineStatus) (bool, error) {
 	return true, nil
 }
 
-func (driver *S3Driver) makeReady(failure *models.BuildFailure) (status *models.PipelineStatus, err error) {
+func (driver *S3Driver) makeReady(failure *models.BuildFailure, force bool) (status *models.PipelineStatus, err error) {
 	status = &models.PipelineStatus{}
 	ok, err := driver.Load(status)
 	if ok {
@@ -151,6 +347,49 @@ func (driver *S3Driver) makeReady(failure *models.BuildFailure) (status *models.
 			return nil, retErr
 		}
 
+		action := models.Finish
+		if failure != nil {
+			action = models.Fail
+		}
+
+		me := driver.buildIdentity()
+		isOwner := state.IsOwner
+		if driver.PipelineOwnership {
+			isOwner = state.IsPipelineOwner
+		}
+
+		if !isOwner(status, me) {
+			owners := status.Holders
+			if status.Holder != nil {
+				owners = []models.BuildIdentity{*status.Holder}
+			}
+
+			if !force {
+				return nil, fmt.Errorf("Cannot %s pipeline %s, it was started by %s and not by %s, set force to override",
+					action, status.Pipeline, state.DescribeBuild(owners[0]), state.DescribeBuild(me))
+			}
+
+			if len(status.Holders) > 0 {
+				// Forcing would free a slot of some other build, so freeing
+				// slots is left to force_ready, which frees them all.
+				return nil, fmt.Errorf("Cannot force %s of pipeline %s, its slots are held by %s, use %s to free them",
+					action, status.Pipeline, state.DescribeBuilds(status.Holders), models.ForceReady)
+			}
+
+			driver.Log.Warn("Forcing "+string(action)+" of pipeline", "pipeline", status.Pipeline,
+				"started_by", state.DescribeBuild(owners[0]), "by", state.DescribeBuild(me))
+			me = owners[0]
+		}
+
+		if driver.Slots > 0 {
+			newStatus, err := driver.machine().Release(status, me, failure)
+			if err != nil {
+				return nil, err
+			}
+
+			return newStatus, driver.persistChange(status, newStatus)
+		}
+
 		if ok, err = driver.changeAndPersistState(status, models.StateReady, failure); ok {
 			return status, err
 		}
@@ -177,34 +416,90 @@ func (driver *S3Driver) getPreStartInitialState() string {
 	return strconv.Itoa(initVersion - 1)
 }
 
+// SetEnv replaces the environment the build metadata is read from.
+func (driver *S3Driver) SetEnv(env venv.Env) {
+	driver.Env = env
+}
+
+func (driver *S3Driver) buildIdentity() models.BuildIdentity {
+	return models.BuildIdentity{
+		Team:     driver.Env.Getenv("BUILD_TEAM_NAME"),
+		Pipeline: driver.Env.Getenv("BUILD_PIPELINE_NAME"),
+		Job:      driver.Env.Getenv("BUILD_JOB_NAME"),
+		Build:    driver.Env.Getenv("BUILD_NAME"),
+		ID:       driver.Env.Getenv("BUILD_ID"),
+	}
+}
+
+// buildURL links to the build acting on the status, or is empty outside of
+// Concourse.
+func (driver *S3Driver) buildURL() string {
+	external := driver.Env.Getenv("ATC_EXTERNAL_URL")
+	if external == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("%s/teams/%s/pipelines/%s/jobs/%s/builds/%s",
+		external,
+		driver.Env.Getenv("BUILD_TEAM_NAME"),
+		driver.Env.Getenv("BUILD_PIPELINE_NAME"),
+		driver.Env.Getenv("BUILD_JOB_NAME"),
+		driver.Env.Getenv("BUILD_NAME"))
+}
+
+func (driver *S3Driver) now() time.Time {
+	if driver.Clock == nil {
+		return time.Now()
+	}
+
+	return driver.Clock.Now()
+}
+
+// waitersAhead counts the builds that must start before the given one. With
+// a queue that is everyone ahead of it in line, otherwise only the builds
+// waiting with a higher priority.
+func (driver *S3Driver) waitersAhead(tickets []models.QueueTicket, build models.BuildIdentity) int {
+	if driver.Queue {
+		return state.QueuePosition(tickets, build)
+	}
+
+	return state.HigherPriorityWaiters(tickets, build)
+}
+
+func (driver *S3Driver) queueTimeout() time.Duration {
+	if driver.QueueTimeout <= 0 {
+		return models.DefaultQueueTimeout
+	}
+
+	return driver.QueueTimeout
+}
+
+func (driver *S3Driver) machine() *state.Machine {
+	machine := driver.Machine
+	if machine == nil {
+		machine = state.Default()
+	}
+
+	if machine.Clock == nil {
+		machine.Clock = driver.Clock
+	}
+	if machine.Log == nil {
+		machine.Log = driver.Log
+	}
+
+	return machine
+}
+
 func (driver *S3Driver) changeAndPersistState(status *models.PipelineStatus,
 	pipelineState models.PipelineState,
 	failure *models.BuildFailure) (ok bool, err error) {
 	if status != nil {
+		previous := *status
 		status.Failure = failure
-		status, err = state.ChangeState(status, pipelineState, failure)
+		status, err = driver.machine().ChangeState(status, pipelineState, failure)
 
 		if err == nil {
-			outputYaml, marshalError := yaml.Marshal(status)
-			if marshalError != nil {
-				err = marshalError
-			}
-
-			if err == nil {
-				params := &s3.PutObjectInput{
-					Bucket:      aws.String(driver.BucketName),
-					Key:         aws.String(driver.Key),
-					ContentType: aws.String("text/plain"),
-					Body:        bytes.NewReader(outputYaml),
-					ACL:         aws.String(s3.ObjectCannedACLPrivate),
-				}
-
-				if len(driver.ServerSideEncryption) > 0 {
-					params.ServerSideEncryption = aws.String(driver.ServerSideEncryption)
-				}
-
-				_, err = driver.Svc.PutObject(params)
-			}
+			err = driver.persistChange(&previous, status)
 		}
 	} else {
 		err = fmt.Errorf("status was nil")
@@ -213,3 +508,104 @@ func (driver *S3Driver) changeAndPersistState(status *models.PipelineStatus,
 	ok = (err == nil)
 	return
 }
+
+func (driver *S3Driver) persist(status *models.PipelineStatus) error {
+	format := driver.Format
+	if format == "" {
+		format = schema.FormatYAML
+	}
+
+	key, err := ExpandKey(driver.Key, driver.Env)
+	if err != nil {
+		return err
+	}
+
+	if len(status.Queue) > 0 {
+		// Tickets are kept in objects of their own. Statuses written by
+		// earlier versions carried them inline, and lose them here.
+		stored := *status
+		stored.Queue = nil
+		status = &stored
+	}
+
+	output, err := schema.EncodeAs(status, format)
+	if err != nil {
+		return err
+	}
+
+	params := &s3.PutObjectInput{
+		Bucket:      aws.String(driver.BucketName),
+		Key:         aws.String(key),
+		ContentType: aws.String(schema.ContentType(format)),
+		Body:        bytes.NewReader(output),
+		ACL:         aws.String(s3.ObjectCannedACLPrivate),
+	}
+
+	driver.encryptPut(params)
+
+	done := driver.Log.Timed("Stored status", "bucket", driver.BucketName, "key", key, "state", status.State)
+	_, err = driver.Svc.PutObject(params)
+	done(err)
+	if err != nil {
+		return err
+	}
+
+	if driver.Badge {
+		driver.uploadBadge(key, status)
+	}
+
+	return nil
+}
+
+// persistChange stores the status and tells the hooks how it changed from
+// the previous one.
+func (driver *S3Driver) persistChange(previous *models.PipelineStatus, status *models.PipelineStatus) error {
+	if err := driver.persist(status); err != nil {
+		return err
+	}
+
+	if len(driver.Hooks) > 0 {
+		key, _ := ExpandKey(driver.Key, driver.Env)
+		if event, ok := notify.NewEvent(key, previous, status, driver.buildIdentity()); ok {
+			event.URL = driver.buildURL()
+			notify.NotifyAll(driver.Hooks, event, driver.Log)
+		}
+	}
+
+	return nil
+}
+
+// uploadBadge stores a badge for the status next to it. The status has
+// already been stored, so failing to store the badge is only reported.
+func (driver *S3Driver) uploadBadge(key string, status *models.PipelineStatus) {
+	acl := driver.BadgeACL
+	if acl == "" {
+		acl = s3.ObjectCannedACLPrivate
+	}
+
+	params := &s3.PutObjectInput{
+		Bucket:       aws.String(driver.BucketName),
+		Key:          aws.String(BadgeKey(key)),
+		ContentType:  aws.String(badge.ContentType),
+		CacheControl: aws.String(badge.CacheControl),
+		Body:         bytes.NewReader(badge.ForStatus(status, driver.now()).SVG()),
+		ACL:          aws.String(acl),
+	}
+
+	driver.encryptBadge(params)
+
+	done := driver.Log.Timed("Uploaded badge", "bucket", driver.BucketName, "key", BadgeKey(key))
+	_, err := driver.Svc.PutObject(params)
+	done(err)
+}
+
+func isNotFound(err error) bool {
+	s3err, ok := err.(awserr.RequestFailure)
+	return ok && s3err.StatusCode() == 404
+}
+
+// BadgeKey returns the key the badge for the status stored under the given
+// key is uploaded to, replacing its extension with .svg.
+func BadgeKey(key string) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + ".svg"
+}
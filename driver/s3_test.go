@@ -1,14 +1,32 @@
 package driver_test
 
 import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
 	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
 
 	"github.com/adammck/venv"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/s3"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/pivotalservices/pipeline-status-resource/blackout"
+	"github.com/pivotalservices/pipeline-status-resource/clock"
 	"github.com/pivotalservices/pipeline-status-resource/driver"
+	"github.com/pivotalservices/pipeline-status-resource/logger"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/notify"
+	"github.com/pivotalservices/pipeline-status-resource/schema"
+	"github.com/pivotalservices/pipeline-status-resource/state"
 )
 
 var mockEnv venv.Env = venv.Mock()
@@ -20,7 +38,7 @@ var _ = BeforeSuite(func() {
 var _ = Describe("S3 Driver", func() {
 	Context("with encryption", func() {
 		It("sets it when enabled", func() {
-			s := &service{}
+			s := newService(sampleYaml)
 			d := driver.S3Driver{
 				Svc:                  s,
 				Env:                  mockEnv,
@@ -30,7 +48,7 @@ var _ = Describe("S3 Driver", func() {
 			Expect(*s.params.ServerSideEncryption).To(Equal("my-encryption-schema"))
 		})
 		It("leaves it empty when disabled", func() {
-			s := &service{}
+			s := newService(sampleYaml)
 			d := driver.S3Driver{
 				Svc: s,
 				Env: mockEnv,
@@ -38,15 +56,892 @@ var _ = Describe("S3 Driver", func() {
 			d.Start()
 			Expect(s.params.ServerSideEncryption).To(BeNil())
 		})
+		It("passes the KMS key", func() {
+			s := newService(sampleYaml)
+			d := driver.S3Driver{
+				Svc:                  s,
+				Env:                  mockEnv,
+				ServerSideEncryption: "aws:kms",
+				SSEKMSKeyID:          "alias/pipeline-status",
+			}
+			d.Start()
+			Expect(*s.params.ServerSideEncryption).To(Equal("aws:kms"))
+			Expect(*s.params.SSEKMSKeyId).To(Equal("alias/pipeline-status"))
+			Expect(s.getParams.SSECustomerKey).To(BeNil())
+		})
+		It("sends the KMS encryption context with objects stored with KMS", func() {
+			handler := driver.EncryptionContextHandler(map[string]string{"team": "foo", "app": "deploy"})
+
+			put := &request.Request{
+				Params:      &s3.PutObjectInput{ServerSideEncryption: aws.String("aws:kms")},
+				HTTPRequest: &http.Request{Header: http.Header{}},
+			}
+			handler(put)
+			context, err := base64.StdEncoding.DecodeString(put.HTTPRequest.Header.Get("X-Amz-Server-Side-Encryption-Context"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(context).To(MatchJSON(`{"app": "deploy", "team": "foo"}`))
+
+			badge := &request.Request{
+				Params:      &s3.PutObjectInput{ServerSideEncryption: aws.String("AES256")},
+				HTTPRequest: &http.Request{Header: http.Header{}},
+			}
+			handler(badge)
+			Expect(badge.HTTPRequest.Header).NotTo(HaveKey("X-Amz-Server-Side-Encryption-Context"))
+
+			get := &request.Request{Params: &s3.GetObjectInput{}, HTTPRequest: &http.Request{Header: http.Header{}}}
+			handler(get)
+			Expect(get.HTTPRequest.Header).To(BeEmpty())
+		})
+		It("reads and writes with a customer key", func() {
+			key := []byte("0123456789abcdef0123456789abcdef")
+			sum := md5.Sum(key)
+
+			s := newService(sampleYaml)
+			d := driver.S3Driver{
+				Svc:            s,
+				Env:            mockEnv,
+				SSECustomerKey: key,
+			}
+			d.Start()
+			Expect(s.params.ServerSideEncryption).To(BeNil())
+			Expect(*s.params.SSECustomerAlgorithm).To(Equal("AES256"))
+			Expect(*s.params.SSECustomerKey).To(Equal(string(key)))
+			Expect(*s.params.SSECustomerKeyMD5).To(Equal(base64.StdEncoding.EncodeToString(sum[:])))
+
+			Expect(*s.getParams.SSECustomerAlgorithm).To(Equal("AES256"))
+			Expect(*s.getParams.SSECustomerKey).To(Equal(string(key)))
+			Expect(*s.getParams.SSECustomerKeyMD5).To(Equal(base64.StdEncoding.EncodeToString(sum[:])))
+		})
+		It("validates the combinations up front", func() {
+			customerKey := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+			for source, message := range map[*models.Source]string{
+				{SSEKMSKeyID: "alias/pipeline-status"}:                                                 "sse_kms_key_id and sse_kms_encryption_context need server_side_encryption aws:kms",
+				{ServerSideEncryption: "AES256", SSEKMSEncryptionContext: map[string]string{"a": "b"}}: "sse_kms_key_id and sse_kms_encryption_context need server_side_encryption aws:kms",
+				{ServerSideEncryption: "aws:kms", SSECustomerKey: customerKey}:                         "sse_customer_key cannot be combined with server_side_encryption",
+				{DisableSSL: true, SSECustomerKey: customerKey}:                                        "sse_customer_key cannot be combined with disable_ssl, customer keys are only accepted over HTTPS",
+				{Badge: true, SSECustomerKey: customerKey}:                                             "sse_customer_key cannot be combined with badge, a badge encrypted with a customer key cannot be shown",
+				{SSECustomerKey: "c2hvcnQ="}:                                                           "sse_customer_key must be a base64 encoded 256-bit key",
+				{SSECustomerKey: "not base64!"}:                                                        "sse_customer_key must be a base64 encoded 256-bit key",
+			} {
+				source.Bucket = "statuses"
+				source.Key = "status"
+				_, err := driver.FromSource(*source)
+				Expect(err).To(MatchError(message))
+			}
+
+			_, err := driver.FromSource(models.Source{Bucket: "statuses", Key: "status", ServerSideEncryption: "aws:kms",
+				SSEKMSKeyID: "alias/pipeline-status", SSEKMSEncryptionContext: map[string]string{"a": "b"}})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = driver.FromSource(models.Source{Bucket: "statuses", Key: "status", SSECustomerKey: customerKey})
+			Expect(err).NotTo(HaveOccurred())
+		})
 	})
-})
 
-type service struct {
-	params *s3.PutObjectInput
-}
+	Context("with a templated key", func() {
+		It("fills it from the build metadata", func() {
+			s := newService(sampleYaml)
+			d := driver.S3Driver{
+				Svc: s,
+				Env: mockEnv,
+				Key: "status/{{team}}/{{ pipeline }}.yml",
+			}
+			_, err := d.Start()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*s.params.Key).To(Equal("status/foo/bar.yml"))
+		})
+
+		It("refuses to load without the build metadata", func() {
+			d := driver.S3Driver{
+				Svc: newService(sampleYaml),
+				Env: venv.Mock(),
+				Key: "status/{{team}}/{{pipeline}}.yml",
+			}
+			_, err := d.Load(&models.PipelineStatus{})
+			Expect(err).To(MatchError("Cannot fill {{team}} in key status/{{team}}/{{pipeline}}.yml, BUILD_TEAM_NAME is not set"))
+		})
+
+		It("reports no versions when checked without the build metadata", func() {
+			s := newService(sampleYaml)
+			d := driver.S3Driver{
+				Svc: s,
+				Env: venv.Mock(),
+				Key: "status/{{team}}/{{pipeline}}.yml",
+				Log: logger.New(GinkgoWriter, logger.Info),
+			}
+			versions, err := d.Check("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(versions).To(BeEmpty())
+			Expect(s.getParams).To(BeNil())
+		})
+
+		It("rejects unknown placeholders", func() {
+			_, err := driver.FromSource(models.Source{Key: "status/{{job}}.yml"})
+			Expect(err).To(MatchError("Unknown placeholder {{job}} in key status/{{job}}.yml, expected {{team}} or {{pipeline}}"))
+		})
+	})
+
+	It("records how long the build waited to start", func() {
+		s := driver.NewMemoryServicer(nil)
+		now := time.Date(2017, 9, 18, 10, 0, 0, 0, time.UTC)
+		d := driver.S3Driver{
+			Svc:   s,
+			Env:   mockEnv,
+			Key:   "status.yml",
+			Clock: clock.Fixed(now),
+		}
+		d.SetWaitStart(now.Add(-45 * time.Second))
+		_, err := d.Start()
+		Expect(err).NotTo(HaveOccurred())
+
+		status := &models.PipelineStatus{}
+		_, err = d.Load(status)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Stats.LastLockWaitSeconds).To(Equal(45.0))
+	})
+
+	Context("with badges", func() {
+		It("uploads a badge next to the status", func() {
+			s := driver.NewMemoryServicer(nil)
+			d := driver.S3Driver{
+				Svc:      s,
+				Env:      mockEnv,
+				Key:      "status/bar.yml",
+				Badge:    true,
+				BadgeACL: "public-read",
+			}
+			_, err := d.Start()
+			Expect(err).NotTo(HaveOccurred())
+
+			out, err := s.GetObject(&s3.GetObjectInput{Key: aws.String("status/bar.svg")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*out.ContentType).To(Equal("image/svg+xml"))
+			Expect(*out.CacheControl).To(Equal("no-cache, max-age=0"))
+
+			body, err := ioutil.ReadAll(out.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(body)).To(ContainSubstring("bar: running #1"))
+		})
+
+		It("encrypts the badge with keys managed by S3 instead of KMS", func() {
+			s := newService(sampleYaml)
+			d := driver.S3Driver{
+				Svc:                  s,
+				Env:                  mockEnv,
+				Key:                  "status/bar.yml",
+				Badge:                true,
+				ServerSideEncryption: "aws:kms",
+				SSEKMSKeyID:          "alias/pipeline-status",
+			}
+			_, err := d.Start()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*s.params.Key).To(Equal("status/bar.svg"))
+			Expect(*s.params.ServerSideEncryption).To(Equal("AES256"))
+			Expect(s.params.SSEKMSKeyId).To(BeNil())
+		})
+
+		It("names the badge after the status key", func() {
+			Expect(driver.BadgeKey("status/deploy.yml")).To(Equal("status/deploy.svg"))
+			Expect(driver.BadgeKey("status")).To(Equal("status.svg"))
+		})
+
+		It("rejects status keys the badge would overwrite", func() {
+			_, err := driver.FromSource(models.Source{Bucket: "statuses", Key: "status/deploy.svg", Badge: true})
+			Expect(err).To(MatchError("key status/deploy.svg cannot be used with badge, the badge would be uploaded over the status"))
+
+			_, err = driver.FromSource(models.Source{Bucket: "statuses", Keys: []string{"a.yml", "b.svg"}, Badge: true})
+			Expect(err).To(MatchError("key b.svg cannot be used with badge, the badge would be uploaded over the status"))
+		})
+	})
+
+	Context("with a debug logger", func() {
+		It("logs every storage call with its duration", func() {
+			out := &bytes.Buffer{}
+			d := driver.S3Driver{
+				Svc:        driver.NewMemoryServicer(nil),
+				Env:        mockEnv,
+				BucketName: "statuses",
+				Key:        "status/bar.yml",
+				Log:        logger.New(out, logger.Debug),
+			}
+			_, err := d.Start()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(out.String()).To(MatchRegexp(`msg="Loaded status" bucket=statuses key=status/bar.yml duration=\S+`))
+			Expect(out.String()).To(ContainSubstring(`msg="Changing state" pipeline=bar from="" to=RUNNING`))
+			Expect(out.String()).To(MatchRegexp(`msg="Stored status" bucket=statuses key=status/bar.yml state=RUNNING duration=\S+`))
+		})
+	})
+
+	Context("with hooks", func() {
+		var (
+			hook *recordingHook
+			d    driver.S3Driver
+		)
+
+		BeforeEach(func() {
+			hook = &recordingHook{}
+			d = driver.S3Driver{
+				Svc:   driver.NewMemoryServicer(nil),
+				Env:   mockEnv,
+				Key:   "status/bar.yml",
+				Hooks: []notify.Hook{hook},
+			}
+		})
+
+		It("tells them about each transition once it is stored", func() {
+			_, err := d.Start()
+			Expect(err).NotTo(HaveOccurred())
+			_, err = d.Start()
+			Expect(err).NotTo(HaveOccurred())
+			_, err = d.Fail(false)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(hook.events).To(HaveLen(2))
+			Expect(hook.events[0].Name).To(Equal(notify.EventRunning))
+			Expect(hook.events[0].Key).To(Equal("status/bar.yml"))
+			Expect(hook.events[0].Build).To(Equal("1"))
+			Expect(hook.events[1].Name).To(Equal(notify.EventFailed))
+			Expect(hook.events[1].From).To(Equal(models.StateRunning))
+			Expect(hook.events[1].To).To(Equal(models.StateReady))
+		})
+
+		It("tells them from check how long a running status has held the lock", func() {
+			now := time.Date(2017, 9, 18, 12, 0, 0, 0, time.UTC)
+			d.Clock = clock.Fixed(now.Add(-2 * time.Hour))
+			_, err := d.Start()
+			Expect(err).NotTo(HaveOccurred())
+
+			d.Clock = clock.Fixed(now)
+			_, err = d.Check("")
+			Expect(err).NotTo(HaveOccurred())
+			d.Clock = clock.Fixed(now.Add(time.Minute))
+			_, err = d.Check("")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(hook.events).To(HaveLen(3))
+			Expect(hook.events[1].Name).To(Equal(notify.EventLongLock))
+			Expect(hook.events[1].Held).To(Equal(2 * time.Hour))
+			Expect(hook.events[1].HeldBefore).To(BeZero())
+			Expect(hook.events[1].By.Pipeline).To(Equal("bar"))
+			Expect(hook.events[2].Held).To(Equal(2*time.Hour + time.Minute))
+			Expect(hook.events[2].HeldBefore).To(Equal(2 * time.Hour))
+
+			_, err = d.Finish(false)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = d.Check("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hook.events).To(HaveLen(4))
+			Expect(hook.events[3].Name).To(Equal(notify.EventReady))
+		})
+
+		It("does not fail the step when a hook fails", func() {
+			hook.err = fmt.Errorf("connection refused")
+
+			_, err := d.Start()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hook.events).To(HaveLen(1))
+		})
+
+		It("stays quiet when the status cannot be stored", func() {
+			s := newService(sampleYaml)
+			s.putError = fmt.Errorf("access denied")
+			d.Svc = s
+
+			_, err := d.Start()
+			Expect(err).To(HaveOccurred())
+			Expect(hook.events).To(BeEmpty())
+		})
+	})
+
+	Context("with the JSON format", func() {
+		It("stores the status as JSON", func() {
+			s := newService(sampleYaml)
+			d := driver.S3Driver{
+				Svc:    s,
+				Env:    mockEnv,
+				Format: schema.FormatJSON,
+			}
+			_, err := d.Start()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*s.params.ContentType).To(Equal("application/json"))
+
+			body, err := ioutil.ReadAll(s.params.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(body)).To(HavePrefix("{"))
+			Expect(string(body)).To(ContainSubstring(`"state": "RUNNING"`))
+		})
+
+		It("reads a status stored as JSON", func() {
+			s := newService(`{"team": "foo", "pipeline": "bar", "build": "7", "state": "READY"}`)
+			d := driver.S3Driver{
+				Svc: s,
+				Env: mockEnv,
+			}
+			status := &models.PipelineStatus{}
+			ok, err := d.Load(status)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(status.BuildNumber).To(Equal("7"))
+		})
+	})
+
+	Context("with custom states", func() {
+		var s *service
+		var d driver.S3Driver
+
+		BeforeEach(func() {
+			machine, err := state.NewMachine(
+				[]models.PipelineState{"MAINTENANCE"},
+				[]models.StateTransition{
+					{From: []models.PipelineState{models.StateReady}, To: "MAINTENANCE"},
+				})
+			Expect(err).NotTo(HaveOccurred())
+
+			s = newService(sampleYaml)
+			d = driver.S3Driver{
+				Svc:     s,
+				Env:     mockEnv,
+				Machine: machine,
+			}
+		})
+
+		It("persists an allowed transition", func() {
+			_, err := d.SetState("MAINTENANCE")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(s.params).NotTo(BeNil())
+
+			body, _ := ioutil.ReadAll(s.params.Body)
+			Expect(string(body)).To(ContainSubstring("state: MAINTENANCE"))
+		})
+
+		It("rejects an illegal transition without persisting", func() {
+			_, err := d.SetState("BLOCKED")
+			Expect(err).To(HaveOccurred())
+			Expect(s.params).To(BeNil())
+		})
+
+		It("refuses to take the lock", func() {
+			store(s.MemoryServicer, "", "team: foo\npipeline: bar\nbuild: 3\nstate: READY\n")
+			_, err := d.SetState(models.StateRunning)
+			Expect(err).To(MatchError("Cannot set the state of pipeline bar to RUNNING, use the start action"))
+			Expect(s.params).To(BeNil())
+		})
+
+		It("refuses to release the lock", func() {
+			store(s.MemoryServicer, "", "team: foo\npipeline: bar\nbuild: 3\nstate: RUNNING\n")
+			for _, target := range []models.PipelineState{models.StateReady, "MAINTENANCE"} {
+				_, err := d.SetState(target)
+				Expect(err).To(MatchError("Cannot set the state of pipeline bar while it is RUNNING, use the finish or fail action, or force_ready"))
+			}
+			Expect(s.params).To(BeNil())
+		})
+
+		It("moves back to READY from a custom state", func() {
+			store(s.MemoryServicer, "", "team: foo\npipeline: bar\nbuild: 3\nstate: MAINTENANCE\n")
+			machine, err := state.NewMachine([]models.PipelineState{"MAINTENANCE"}, []models.StateTransition{
+				{From: []models.PipelineState{"MAINTENANCE"}, To: models.StateReady},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			d.Machine = machine
+
+			_, err = d.SetState(models.StateReady)
+			Expect(err).NotTo(HaveOccurred())
+
+			body, _ := ioutil.ReadAll(s.params.Body)
+			Expect(string(body)).To(ContainSubstring("state: READY"))
+		})
+	})
+
+	Context("with a status owned by another pipeline", func() {
+		otherYaml := `
+team: other-team
+pipeline: other-pipeline
+build: 3
+state: READY
+`
+		var s *service
+		var d driver.S3Driver
+
+		BeforeEach(func() {
+			mockEnv.Setenv("BUILD_JOB_NAME", "deploy")
+			mockEnv.Setenv("BUILD_NAME", "12")
+
+			s = newService(otherYaml)
+			d = driver.S3Driver{
+				Svc: s,
+				Env: mockEnv,
+			}
+		})
+
+		AfterEach(func() {
+			mockEnv.Setenv("BUILD_JOB_NAME", "")
+			mockEnv.Setenv("BUILD_NAME", "")
+		})
+
+		It("refuses to start without a shared lock", func() {
+			_, err := d.Start()
+			Expect(err).To(MatchError(ContainSubstring("set shared_lock to share it")))
+			Expect(s.params).To(BeNil())
+		})
+
+		It("starts and records the holder with a shared lock", func() {
+			d.SharedLock = true
+			_, err := d.Start()
+			Expect(err).NotTo(HaveOccurred())
+
+			body, _ := ioutil.ReadAll(s.params.Body)
+			status := models.PipelineStatus{}
+			Expect(yaml.Unmarshal(body, &status)).To(Succeed())
+			Expect(status.State).To(Equal(models.StateRunning))
+			Expect(status.Pipeline).To(Equal("other-pipeline"))
+			Expect(status.Holder).To(Equal(&models.BuildIdentity{
+				Team:     "foo",
+				Pipeline: "bar",
+				Job:      "deploy",
+				Build:    "12",
+			}))
+		})
+
+		It("clears the holder when finished", func() {
+			held := otherYaml + "holder:\n  team: foo\n  pipeline: bar\n  job: deploy\n  build: \"12\"\n"
+			store(s.MemoryServicer, "", strings.Replace(held, "READY", "RUNNING", 1))
+			_, err := d.Finish(false)
+			Expect(err).NotTo(HaveOccurred())
+
+			body, _ := ioutil.ReadAll(s.params.Body)
+			Expect(string(body)).NotTo(ContainSubstring("holder"))
+		})
+
+		It("lets another job of the pipeline finish it with pipeline ownership", func() {
+			held := otherYaml + "holder:\n  team: foo\n  pipeline: bar\n  job: build\n  build: \"11\"\n"
+			store(s.MemoryServicer, "", strings.Replace(held, "READY", "RUNNING", 1))
+			_, err := d.Finish(false)
+			Expect(err).To(MatchError(ContainSubstring("it was started by foo/bar/build #11 and not by foo/bar/deploy #12")))
+
+			d.PipelineOwnership = true
+			_, err = d.Finish(false)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("with a run started by another pipeline", func() {
+		heldYaml := `
+team: foo
+pipeline: bar
+build: 4
+state: RUNNING
+holder:
+  team: foo
+  pipeline: other
+  job: deploy
+  build: "1"
+`
+		var s *service
+		var d driver.S3Driver
+
+		BeforeEach(func() {
+			s = newService(heldYaml)
+			d = driver.S3Driver{
+				Svc: s,
+				Env: mockEnv,
+			}
+		})
+
+		It("refuses to finish it", func() {
+			_, err := d.Finish(false)
+			Expect(err).To(MatchError(ContainSubstring("it was started by foo/other/deploy #1 and not by foo/bar, set force to override")))
+			Expect(s.params).To(BeNil())
+		})
+
+		It("refuses to force it ready without admin actions", func() {
+			_, err := d.ForceReady("wedged")
+			Expect(err).To(MatchError(ContainSubstring("requires allow_admin_actions")))
+			Expect(s.params).To(BeNil())
+		})
+
+		It("refuses to force it ready without a reason", func() {
+			d.AllowAdminActions = true
+			_, err := d.ForceReady("")
+			Expect(err).To(MatchError(ContainSubstring("requires a reason")))
+			Expect(s.params).To(BeNil())
+		})
+
+		It("forces it ready with admin actions", func() {
+			d.AllowAdminActions = true
+			status, err := d.ForceReady("wedged")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.State).To(Equal(models.StateReady))
+			Expect(status.History).To(HaveLen(1))
+			Expect(status.History[0].Holders[0].Pipeline).To(Equal("other"))
+			Expect(status.History[0].Reason).To(Equal("wedged"))
+			Expect(s.params).NotTo(BeNil())
+		})
+
+		It("finishes it when forced", func() {
+			status, err := d.Finish(true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status).NotTo(BeNil())
+			Expect(s.params).NotTo(BeNil())
+
+			body, _ := ioutil.ReadAll(s.params.Body)
+			Expect(string(body)).To(ContainSubstring("state: READY"))
+		})
+	})
+
+	Context("with slots", func() {
+		runningYaml := `
+team: foo
+pipeline: bar
+build: 4
+state: RUNNING
+holders:
+- team: foo
+  pipeline: bar
+  job: deploy
+  build: "1"
+`
+		var s *service
+		var d driver.S3Driver
+
+		BeforeEach(func() {
+			mockEnv.Setenv("BUILD_JOB_NAME", "deploy")
+			mockEnv.Setenv("BUILD_NAME", "2")
+
+			s = newService(runningYaml)
+			d = driver.S3Driver{
+				Svc: s,
+				Env: mockEnv,
+			}
+		})
+
+		AfterEach(func() {
+			mockEnv.Setenv("BUILD_JOB_NAME", "")
+			mockEnv.Setenv("BUILD_NAME", "")
+		})
+
+		It("starts while a slot is free", func() {
+			d.Slots = 2
+			status, err := d.Start()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.BuildNumber).To(Equal("5"))
+			Expect(status.Holders).To(HaveLen(2))
+			Expect(s.params).NotTo(BeNil())
+		})
+
+		It("refuses to start when every slot is taken", func() {
+			d.Slots = 1
+			_, err := d.Start()
+			Expect(err).To(MatchError(ContainSubstring("All 1 slots are taken")))
+			Expect(s.params).To(BeNil())
+		})
+
+		It("releases the build's slot when finished", func() {
+			mockEnv.Setenv("BUILD_NAME", "1")
+			d.Slots = 2
+			status, err := d.Finish(false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.State).To(Equal(models.StateReady))
+			Expect(status.Holders).To(BeEmpty())
+		})
+
+		It("refuses to force the release of another pipeline's slot", func() {
+			store(s.MemoryServicer, "", strings.Replace(runningYaml, "  pipeline: bar\n  job", "  pipeline: other\n  job", 1))
+			d.Slots = 2
+			_, err := d.Finish(true)
+			Expect(err).To(MatchError("Cannot force finish of pipeline bar, its slots are held by foo/other/deploy #1, use force_ready to free them"))
+			Expect(s.params).To(BeNil())
+		})
+	})
+
+	Context("with a queue", func() {
+		statusYaml := `
+team: foo
+pipeline: bar
+build: 4
+state: READY
+`
+		ticketYaml := `
+build:
+  team: foo
+  pipeline: bar
+  job: deploy
+  build: "1"
+enqueued: 2017-09-18T09:59:00+0000
+seen: %s
+`
+		ownTicket := "status.yml.queue/" + "foo%2Fbar%2Fdeploy%2F2"
+
+		var s *driver.MemoryServicer
+		var d driver.S3Driver
+		now := time.Date(2017, 9, 18, 10, 0, 0, 0, time.UTC)
+
+		queued := func(seen string, extra string) {
+			s = driver.NewMemoryServicer(map[string]string{
+				"status.yml":          statusYaml,
+				"status.yml.queue/41": fmt.Sprintf(ticketYaml, seen) + extra,
+			})
+			d.Svc = s
+		}
+
+		BeforeEach(func() {
+			mockEnv.Setenv("BUILD_JOB_NAME", "deploy")
+			mockEnv.Setenv("BUILD_NAME", "2")
+
+			d = driver.S3Driver{
+				Env:          mockEnv,
+				Key:          "status.yml",
+				Queue:        true,
+				QueueTimeout: time.Minute,
+				Clock:        clock.Fixed(now),
+			}
+		})
+
+		AfterEach(func() {
+			mockEnv.Setenv("BUILD_JOB_NAME", "")
+			mockEnv.Setenv("BUILD_NAME", "")
+		})
+
+		It("rejects a queue_timeout that does not outlast retry_after", func() {
+			source := models.Source{Bucket: "statuses", Key: "status.yml", Queue: true, RetryAfter: "5m", QueueTimeout: "5m"}
+			_, err := driver.FromSource(source)
+			Expect(err).To(MatchError("queue_timeout 5m0s must be longer than retry_after 5m0s"))
+
+			source.QueueTimeout = ""
+			source.RetryAfter = "15m"
+			_, err = driver.FromSource(source)
+			Expect(err).To(MatchError("queue_timeout 10m0s must be longer than retry_after 15m0s"))
+
+			source.QueueTimeout = "1h"
+			_, err = driver.FromSource(source)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("refuses to start ahead of a queued build", func() {
+			queued("2017-09-18T09:59:30+0000", "")
+			_, err := d.Start()
+			Expect(err).To(MatchError("Cannot start pipeline bar, 1 builds are queued ahead of foo/bar/deploy #2"))
+		})
+
+		It("starts once the queued build has gone stale", func() {
+			queued("2017-09-18T09:58:30+0000", "")
+			_, err := d.Start()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(read(s, "status.yml")).To(ContainSubstring("state: RUNNING"))
+		})
+
+		It("queues behind the existing ticket in an object of its own", func() {
+			queued("2017-09-18T09:59:30+0000", "")
+			ahead, err := d.Enqueue(now, 0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ahead).To(Equal(1))
+
+			Expect(read(s, ownTicket)).To(ContainSubstring(`build: "2"`))
+			Expect(read(s, "status.yml")).To(Equal(statusYaml))
+
+			tickets, err := d.Tickets()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tickets).To(HaveLen(2))
+			Expect(tickets[0].Build.Build).To(Equal("1"))
+		})
+
+		It("jumps the queue with a higher priority", func() {
+			queued("2017-09-18T09:59:30+0000", "")
+			ahead, err := d.Enqueue(now, 10)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ahead).To(Equal(0))
+		})
+
+		It("removes its ticket once started", func() {
+			queued("2017-09-18T09:58:30+0000", "")
+			_, err := d.Enqueue(now, 0)
+			Expect(err).NotTo(HaveOccurred())
 
-func (*service) GetObject(*s3.GetObjectInput) (*s3.GetObjectOutput, error) {
-	sampleYaml := `
+			_, err = d.Start()
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = s.GetObject(&s3.GetObjectInput{Key: aws.String(ownTicket)})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("drops tickets stored in the status by earlier versions", func() {
+			s = driver.NewMemoryServicer(map[string]string{
+				"status.yml": statusYaml + "queue:\n- build:\n    team: foo\n    pipeline: bar\n" +
+					"  enqueued: 2017-09-18T09:59:00+0000\n  seen: 2017-09-18T09:59:30+0000\n",
+			})
+			d.Svc = s
+
+			_, err := d.Start()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(read(s, "status.yml")).NotTo(ContainSubstring("queue"))
+		})
+
+		Context("when only priorities are used", func() {
+			BeforeEach(func() {
+				d.Queue = false
+			})
+
+			It("refuses to start while a higher priority build waits", func() {
+				queued("2017-09-18T09:59:30+0000", "priority: 5\n")
+				_, err := d.Start()
+				Expect(err).To(MatchError(ContainSubstring("1 builds are queued ahead")))
+			})
+
+			It("starts ahead of lower priority waiters", func() {
+				queued("2017-09-18T09:59:30+0000", "priority: -1\n")
+				_, err := d.Start()
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("keeps a status finished while a build is waiting READY", func() {
+				s = driver.NewMemoryServicer(map[string]string{
+					"status.yml": "team: foo\npipeline: bar\nbuild: 4\nstate: RUNNING\n",
+				})
+				holder := d
+				holder.Svc = s
+
+				// The run finishes while the waiter is storing its ticket.
+				finished := false
+				d.Svc = &interleavedService{MemoryServicer: s, beforePut: func() {
+					if !finished {
+						finished = true
+						_, err := holder.Finish(false)
+						Expect(err).NotTo(HaveOccurred())
+					}
+				}}
+
+				ahead, err := d.Enqueue(now, 5)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ahead).To(Equal(0))
+				Expect(finished).To(BeTrue())
+
+				_, err = d.Enqueue(now, 5)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(read(s, "status.yml")).To(ContainSubstring("state: READY"))
+			})
+		})
+	})
+
+	Context("with a freeze", func() {
+		frozenYaml := `
+team: foo
+pipeline: bar
+build: 3
+state: READY
+freeze:
+  frozen_by:
+    team: foo
+    pipeline: bar
+    job: freeze
+    build: "7"
+  frozen_at: 2017-03-14T23:33:45+0000
+  reason: change window
+  expires: %s
+`
+		var s *service
+		var d driver.S3Driver
+
+		BeforeEach(func() {
+			s = newService(sampleYaml)
+			d = driver.S3Driver{
+				Svc: s,
+				Env: mockEnv,
+			}
+		})
+
+		It("records who froze the status", func() {
+			expires := time.Now().Add(time.Hour)
+			status, err := d.Freeze("change window", expires)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.Freeze.Reason).To(Equal("change window"))
+			Expect(status.Freeze.FrozenBy.Team).To(Equal("foo"))
+			Expect(status.Freeze.FrozenBy.Pipeline).To(Equal("bar"))
+			Expect(status.Freeze.Expires).To(Equal(expires.Format(models.ISO8601DateFormat)))
+
+			body, _ := ioutil.ReadAll(s.params.Body)
+			Expect(string(body)).To(ContainSubstring("reason: change window"))
+		})
+
+		It("refuses to start while frozen", func() {
+			store(s.MemoryServicer, "", fmt.Sprintf(frozenYaml, time.Now().Add(time.Hour).Format(models.ISO8601DateFormat)))
+			_, err := d.Start()
+			Expect(err).To(MatchError(ContainSubstring("frozen by foo/bar/freeze #7")))
+			Expect(s.params).To(BeNil())
+		})
+
+		It("starts once the freeze has expired", func() {
+			store(s.MemoryServicer, "", fmt.Sprintf(frozenYaml, time.Now().Add(-time.Hour).Format(models.ISO8601DateFormat)))
+			_, err := d.Start()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(s.params).NotTo(BeNil())
+		})
+
+		It("keeps the checked version when frozen and unfrozen", func() {
+			versions, err := d.Check("3")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(versions).To(Equal([]models.Version{{Number: "3"}}))
+
+			store(s.MemoryServicer, "", fmt.Sprintf(frozenYaml, ""))
+			frozen, err := d.Check("3")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(frozen).To(Equal(versions))
+
+			_, err = d.Unfreeze()
+			Expect(err).NotTo(HaveOccurred())
+			unfrozen, err := d.Check("3")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(unfrozen).To(Equal(versions))
+		})
+
+		It("lifts the freeze", func() {
+			store(s.MemoryServicer, "", fmt.Sprintf(frozenYaml, ""))
+			status, err := d.Unfreeze()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.Freeze).To(BeNil())
+
+			body, _ := ioutil.ReadAll(s.params.Body)
+			Expect(string(body)).NotTo(ContainSubstring("freeze"))
+		})
+	})
+
+	Context("with blackout windows", func() {
+		var s *service
+		var d driver.S3Driver
+
+		BeforeEach(func() {
+			blackouts, err := blackout.FromSource([]models.BlackoutWindow{
+				{Name: "nightly backup", Start: "01:00", End: "03:00"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			s = newService(sampleYaml)
+			d = driver.S3Driver{
+				Svc:       s,
+				Env:       mockEnv,
+				Blackouts: blackouts,
+			}
+		})
+
+		It("refuses to start inside a window and says when it ends", func() {
+			d.Clock = clock.Fixed(time.Date(2017, 9, 18, 2, 0, 0, 0, time.UTC))
+			_, err := d.Start()
+			Expect(err).To(MatchError("Cannot start pipeline bar during nightly backup, it ends at 2017-09-18T03:00:00+0000"))
+			Expect(s.params).To(BeNil())
+		})
+
+		It("starts outside a window", func() {
+			d.Clock = clock.Fixed(time.Date(2017, 9, 18, 3, 0, 0, 0, time.UTC))
+			_, err := d.Start()
+			Expect(err).NotTo(HaveOccurred())
+
+			body, _ := ioutil.ReadAll(s.params.Body)
+			Expect(string(body)).To(ContainSubstring("last_modified: 2017-09-18T03:00:00+0000"))
+		})
+	})
+})
+
+const sampleYaml = `
 ---
 team: foo
 pipeline: bar
@@ -54,13 +949,76 @@ build: 3
 last_modified: 2017-03-14T23:33:45
 state: READY
 `
-	out := &s3.GetObjectOutput{}
-	out.Body = ioutil.NopCloser(strings.NewReader(sampleYaml))
 
-	return out, nil
+// service keeps objects in memory and records the last object read and
+// stored. The tests keep their status under the empty key unless they set
+// one.
+type service struct {
+	*driver.MemoryServicer
+	params    *s3.PutObjectInput
+	getParams *s3.GetObjectInput
+	putError  error
+}
+
+func newService(status string) *service {
+	return &service{MemoryServicer: driver.NewMemoryServicer(map[string]string{"": status})}
+}
+
+func (s *service) GetObject(p *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	s.getParams = p
+	return s.MemoryServicer.GetObject(p)
 }
 
 func (s *service) PutObject(p *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
 	s.params = p
-	return nil, nil
+	if s.putError != nil {
+		return nil, s.putError
+	}
+
+	out, err := s.MemoryServicer.PutObject(p)
+	if err == nil {
+		// Let the tests read the stored body again.
+		_, err = p.Body.Seek(0, io.SeekStart)
+	}
+	return out, err
+}
+
+// read returns the object stored under the key, or an empty string when
+// there is none.
+func read(s driver.Servicer, key string) string {
+	out, err := s.GetObject(&s3.GetObjectInput{Key: aws.String(key)})
+	if err != nil {
+		return ""
+	}
+
+	body, _ := ioutil.ReadAll(out.Body)
+	return string(body)
+}
+
+// store puts the body under the key.
+func store(s driver.Servicer, key string, body string) {
+	_, err := s.PutObject(&s3.PutObjectInput{Key: aws.String(key), Body: strings.NewReader(body)})
+	Expect(err).NotTo(HaveOccurred())
+}
+
+// interleavedService runs beforePut ahead of each object it stores, to
+// simulate another build acting on the status at the same time.
+type interleavedService struct {
+	*driver.MemoryServicer
+	beforePut func()
+}
+
+func (s *interleavedService) PutObject(p *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	s.beforePut()
+	return s.MemoryServicer.PutObject(p)
+}
+
+type recordingHook struct {
+	events []notify.Event
+	err    error
+}
+
+func (h *recordingHook) Notify(event notify.Event) error {
+	h.events = append(h.events, event)
+	return h.err
 }
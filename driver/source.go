@@ -0,0 +1,33 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/schema"
+)
+
+// ReadSource reads a source configuration from a file, written either as
+// JSON or as YAML the way it appears in a pipeline.
+func ReadSource(file string) (models.Source, error) {
+	var source models.Source
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return source, err
+	}
+
+	if schema.Detect(data) == schema.FormatYAML {
+		if data, err = schema.YAMLToJSON(data); err != nil {
+			return source, fmt.Errorf("reading %s: %s", file, err)
+		}
+	}
+
+	if err = json.Unmarshal(data, &source); err != nil {
+		return source, fmt.Errorf("reading %s: %s", file, err)
+	}
+
+	return source, nil
+}
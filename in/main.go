@@ -6,18 +6,25 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"time"
 
 	"gopkg.in/yaml.v2"
 
 	"github.com/pivotalservices/pipeline-status-resource/driver"
+	"github.com/pivotalservices/pipeline-status-resource/logger"
 	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/redact"
+	"github.com/pivotalservices/pipeline-status-resource/schema"
+	"github.com/pivotalservices/pipeline-status-resource/state"
 )
 
 var VERSION = "local-build"
 
+var log = logger.Default
+
 func main() {
 	if len(os.Args) < 2 {
-		println("usage: " + os.Args[0] + " <destination>")
+		log.Error("usage: " + os.Args[0] + " <destination>")
 		os.Exit(1)
 	}
 
@@ -34,47 +41,124 @@ func main() {
 		fatal("reading request", err)
 	}
 
-	if driver.IsDebug(request.Source) {
-		if tmpFile, err := ioutil.TempFile("/tmp", "indbg"); err == nil {
-			json.NewEncoder(tmpFile).Encode(request)
-		} else {
-			fmt.Fprintf(os.Stderr, "Error writing debug output: %v\n", err)
-		}
-	}
+	// An invalid log_level is reported when the driver is constructed.
+	log, _ = logger.FromSource(request.Source)
+	log.Debug("Received request", "request", redact.Request(request))
 
-	driver, err := driver.FromSource(request.Source)
+	d, err := driver.FromSource(request.Source)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		fatal("constructing driver", err)
 	}
 
 	status := &models.PipelineStatus{}
-	ok, err := driver.Load(status)
+	ok, err := d.Load(status)
 	if !ok {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		fatal("fetching status", err)
+	}
+
+	if status.Queue, err = queued(d); err != nil {
+		fatal("fetching queue", err)
 	}
 
 	fileName := path.Join(destination, "status")
 
-	if data, err := yaml.Marshal(status); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+	if data, err := schema.Encode(status); err != nil {
+		fatal("encoding status", err)
 	} else {
 		ioutil.WriteFile(fileName, data, 0644)
 	}
 
+	// Concourse expects the version it asked for back unchanged, so the
+	// current freeze is only reported in the metadata.
+	version := request.Version
+	metadata := models.Metadata{
+		{"number", status.BuildNumber},
+	}
+
+	summaryMetadata, err := writeSummary(d, destination)
+	if err != nil {
+		fatal("writing summary", err)
+	}
+	metadata = append(metadata, summaryMetadata...)
+
+	if blockedBy, err := driver.DescribeBlockingDependency(d); err != nil {
+		fatal("resolving dependencies", err)
+	} else if blockedBy != "" {
+		metadata = append(metadata, models.MetadataField{"blocked_by", blockedBy})
+	}
+
+	if status.Holder != nil {
+		metadata = append(metadata, models.MetadataField{"holder", state.DescribeBuild(*status.Holder)})
+	}
+	for _, holder := range status.Holders {
+		metadata = append(metadata, models.MetadataField{"holder", state.DescribeBuild(holder)})
+	}
+	for _, ticket := range status.Queue {
+		metadata = append(metadata, models.MetadataField{"queued",
+			fmt.Sprintf("%s since %s", state.DescribeBuild(ticket.Build), ticket.Enqueued)})
+	}
+
+	if state.IsFrozen(status, time.Now()) {
+		metadata = append(metadata,
+			models.MetadataField{"frozen", "true"},
+			models.MetadataField{"frozen_by", state.DescribeBuild(status.Freeze.FrozenBy)},
+			models.MetadataField{"frozen_at", status.Freeze.FrozenAt},
+			models.MetadataField{"freeze_reason", status.Freeze.Reason},
+			models.MetadataField{"freeze_expires", status.Freeze.Expires})
+	}
+
 	json.NewEncoder(os.Stdout).Encode(models.InResponse{
-		Version: models.Version{
-			Number: status.BuildNumber,
-		},
-		Metadata: models.Metadata{
-			{"number", status.BuildNumber},
-		},
+		Version:  version,
+		Metadata: metadata,
 	})
 }
 
+// writeSummary writes the combined summary of a driver tracking several
+// statuses to the summary file, and returns metadata listing the state of
+// each of them.
+func writeSummary(d driver.Driver, destination string) (models.Metadata, error) {
+	summarizer, ok := d.(driver.Summarizer)
+	if !ok {
+		return nil, nil
+	}
+
+	summary, err := summarizer.Summary()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := yaml.Marshal(summary)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = ioutil.WriteFile(path.Join(destination, "summary"), data, 0644); err != nil {
+		return nil, err
+	}
+
+	metadata := models.Metadata{{"state", string(summary.State)}}
+	for _, p := range summary.Pipelines {
+		metadata = append(metadata, models.MetadataField{p.Key, string(p.State)})
+	}
+	for _, key := range summary.Failing {
+		metadata = append(metadata, models.MetadataField{"failing", key})
+	}
+
+	return metadata, nil
+}
+
+// queued returns the builds waiting to start, for drivers that keep a
+// queue.
+func queued(d driver.Driver) ([]models.QueueTicket, error) {
+	queuer, ok := d.(driver.Queuer)
+	if !ok {
+		return nil, nil
+	}
+
+	return queuer.Tickets()
+}
+
 func fatal(doing string, err error) {
-	println("error " + doing + ": " + err.Error())
+	log.Error("error "+doing, "error", err)
 	os.Exit(1)
 }
@@ -0,0 +1,251 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pivotalservices/pipeline-status-resource/clock"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/redact"
+)
+
+// Level is the severity of a log line.
+type Level int
+
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < Debug || l > Error {
+		return "unknown"
+	}
+
+	return levelNames[l]
+}
+
+// ParseLevel reads a level by name. An empty name is Info.
+func ParseLevel(name string) (Level, error) {
+	if name == "" {
+		return Info, nil
+	}
+
+	for i, n := range levelNames {
+		if strings.EqualFold(name, n) {
+			return Level(i), nil
+		}
+	}
+
+	return Info, fmt.Errorf("unknown log level %s, expected debug, info, warn or error", name)
+}
+
+// Redacted replaces secrets in log lines.
+const Redacted = redact.Placeholder
+
+// Logger writes leveled log lines as logfmt, e.g.
+//
+//	time=2017-09-18T10:00:00Z level=info msg="stored status" key=deploy.yml duration=23ms
+//
+// Loggers made with With share their output and the secrets they redact.
+// A nil Logger writes to Default.
+type Logger struct {
+	out    *output
+	level  Level
+	fields []interface{}
+}
+
+type output struct {
+	sync.Mutex
+	w       io.Writer
+	clock   clock.Clock
+	secrets []string
+}
+
+// Default writes info and above to stderr.
+var Default = New(os.Stderr, Info)
+
+// New returns a logger writing lines at or above the level to w.
+func New(w io.Writer, level Level) *Logger {
+	return &Logger{out: &output{w: w, clock: clock.System()}, level: level}
+}
+
+// SetClock sets the clock the time of each line is read from.
+func (l *Logger) SetClock(c clock.Clock) {
+	l.out.Lock()
+	defer l.out.Unlock()
+	l.out.clock = c
+}
+
+// SetOutput sets where lines are written.
+func (l *Logger) SetOutput(w io.Writer) {
+	l.out.Lock()
+	defer l.out.Unlock()
+	l.out.w = w
+}
+
+// With returns a logger that adds the key value pairs to every line.
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	l = l.orDefault()
+
+	fields := append(append([]interface{}{}, l.fields...), keyvals...)
+	return &Logger{out: l.out, level: l.level, fields: fields}
+}
+
+// Redact masks the values wherever they would appear in a line, including
+// inside JSON.
+func (l *Logger) Redact(values ...string) {
+	l = l.orDefault()
+
+	l.out.Lock()
+	defer l.out.Unlock()
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+
+		quoted, _ := json.Marshal(value)
+		l.out.secrets = append(l.out.secrets, value, strings.Trim(string(quoted), `"`))
+	}
+}
+
+// Enabled reports whether lines at the level are written.
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.orDefault().level
+}
+
+func (l *Logger) Debug(msg string, keyvals ...interface{}) { l.log(Debug, msg, keyvals) }
+func (l *Logger) Info(msg string, keyvals ...interface{})  { l.log(Info, msg, keyvals) }
+func (l *Logger) Warn(msg string, keyvals ...interface{})  { l.log(Warn, msg, keyvals) }
+func (l *Logger) Error(msg string, keyvals ...interface{}) { l.log(Error, msg, keyvals) }
+
+// Timed starts timing an operation and returns a function that logs it at
+// debug level with its duration, or at warn level when it failed.
+func (l *Logger) Timed(msg string, keyvals ...interface{}) func(err error) {
+	l = l.orDefault()
+
+	started := l.now()
+	return func(err error) {
+		fields := append(append([]interface{}{}, keyvals...), "duration", l.now().Sub(started))
+		if err != nil {
+			l.log(Warn, msg, append(fields, "error", err))
+			return
+		}
+
+		l.log(Debug, msg, fields)
+	}
+}
+
+func (l *Logger) orDefault() *Logger {
+	if l == nil {
+		return Default
+	}
+
+	return l
+}
+
+func (l *Logger) now() time.Time {
+	l.out.Lock()
+	defer l.out.Unlock()
+	return l.out.clock.Now()
+}
+
+func (l *Logger) log(level Level, msg string, keyvals []interface{}) {
+	l = l.orDefault()
+	if !l.Enabled(level) {
+		return
+	}
+
+	now := l.now()
+
+	l.out.Lock()
+	defer l.out.Unlock()
+
+	line := &bytes.Buffer{}
+	l.out.writePair(line, "time", now.UTC().Format(time.RFC3339))
+	l.out.writePair(line, "level", level.String())
+	l.out.writePair(line, "msg", msg)
+
+	fields := append(append([]interface{}{}, l.fields...), keyvals...)
+	for i := 0; i < len(fields); i += 2 {
+		var value interface{} = "(missing)"
+		if i+1 < len(fields) {
+			value = fields[i+1]
+		}
+		l.out.writePair(line, fmt.Sprint(fields[i]), value)
+	}
+
+	fmt.Fprintln(l.out.w, line.String())
+}
+
+// writePair writes key=value, redacting secrets before the value is quoted.
+func (o *output) writePair(line *bytes.Buffer, key string, value interface{}) {
+	text := format(value)
+	for _, secret := range o.secrets {
+		text = strings.Replace(text, secret, Redacted, -1)
+	}
+
+	if line.Len() > 0 {
+		line.WriteByte(' ')
+	}
+	line.WriteString(key)
+	line.WriteByte('=')
+	line.WriteString(quote(text))
+}
+
+func format(value interface{}) string {
+	var text string
+	switch v := value.(type) {
+	case nil:
+		text = "null"
+	case string:
+		text = v
+	case error:
+		text = v.Error()
+	case time.Duration:
+		text = v.String()
+	case fmt.Stringer:
+		text = v.String()
+	default:
+		text = fmt.Sprintf("%+v", v)
+	}
+
+	return text
+}
+
+func quote(text string) string {
+	if text == "" || strings.ContainsAny(text, " =\"\t\n\\") {
+		return strconv.Quote(text)
+	}
+
+	return text
+}
+
+// FromSource returns a logger for the check, in and out scripts writing to
+// stderr at the source's log_level, or at debug level when debug is set. The
+// source's secrets are redacted. When the log_level is invalid the error is
+// returned along with a logger at info level, so the error can be reported
+// without leaking secrets.
+func FromSource(source models.Source) (*Logger, error) {
+	level, err := ParseLevel(source.LogLevel)
+
+	if debug, parseErr := strconv.ParseBool(source.Debug); debug && parseErr == nil {
+		level = Debug
+	}
+
+	log := New(os.Stderr, level)
+	log.Redact(redact.Secrets(source)...)
+
+	return log, err
+}
@@ -0,0 +1,109 @@
+package logger_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotalservices/pipeline-status-resource/clock"
+	"github.com/pivotalservices/pipeline-status-resource/logger"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/redact"
+)
+
+var _ = Describe("Logger", func() {
+	var (
+		out *bytes.Buffer
+		log *logger.Logger
+	)
+
+	BeforeEach(func() {
+		out = &bytes.Buffer{}
+		log = logger.New(out, logger.Info)
+		log.SetClock(clock.Fixed(time.Date(2017, 9, 18, 10, 0, 0, 0, time.UTC)))
+	})
+
+	It("writes logfmt lines", func() {
+		log.Info("Stored status", "key", "status/deploy.yml", "reason", "wedged run", "build", 42)
+		Expect(out.String()).To(Equal(
+			`time=2017-09-18T10:00:00Z level=info msg="Stored status" key=status/deploy.yml reason="wedged run" build=42` + "\n"))
+	})
+
+	It("skips lines below its level", func() {
+		log.Debug("Loaded status")
+		Expect(out.String()).To(BeEmpty())
+		Expect(log.Enabled(logger.Debug)).To(BeFalse())
+		Expect(log.Enabled(logger.Warn)).To(BeTrue())
+	})
+
+	It("adds the fields given to With", func() {
+		log.With("pipeline", "deploy").Warn("Forcing pipeline ready", "by", "main/deploy")
+		Expect(out.String()).To(ContainSubstring(`level=warn msg="Forcing pipeline ready" pipeline=deploy by=main/deploy`))
+	})
+
+	It("redacts secrets, also when quoted", func() {
+		log.Redact("s3cr3t\"key", "")
+		log.With("source", `{"secret_access_key":"s3cr3t\"key"}`).Error("Cannot load", "error", errors.New("bad key s3cr3t\"key"))
+
+		Expect(out.String()).NotTo(ContainSubstring("s3cr3t"))
+		Expect(out.String()).To(ContainSubstring(logger.Redacted))
+	})
+
+	It("times operations", func() {
+		log = logger.New(out, logger.Debug)
+		log.Timed("Loaded status", "key", "deploy.yml")(nil)
+		Expect(out.String()).To(MatchRegexp(`level=debug msg="Loaded status" key=deploy.yml duration=\S+s`))
+
+		out.Reset()
+		log.Timed("Stored status")(errors.New("access denied"))
+		Expect(out.String()).To(MatchRegexp(`level=warn msg="Stored status" duration=\S+ error="access denied"`))
+	})
+
+	It("writes to the default logger when nil", func() {
+		var nilLog *logger.Logger
+		Expect(nilLog.Enabled(logger.Info)).To(BeTrue())
+		Expect(nilLog.With("key", "deploy.yml")).NotTo(BeNil())
+	})
+
+	Describe("FromSource", func() {
+		It("reads the level", func() {
+			log, err := logger.FromSource(models.Source{LogLevel: "warn"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(log.Enabled(logger.Info)).To(BeFalse())
+
+			log, err = logger.FromSource(models.Source{LogLevel: "warn", Debug: "true"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(log.Enabled(logger.Debug)).To(BeTrue())
+		})
+
+		It("redacts the secrets of the source", func() {
+			source := models.Source{
+				Debug:           "true",
+				SecretAccessKey: "aws/secret+value",
+				Password:        "pass<word>",
+				OpenStack:       models.OpenStackOptions{APIKey: "openstack-api-key"},
+			}
+
+			log, err := logger.FromSource(source)
+			Expect(err).NotTo(HaveOccurred())
+			log.SetOutput(out)
+
+			data, err := json.Marshal(source)
+			Expect(err).NotTo(HaveOccurred())
+			log.Debug("Received request", "source", string(data), "error", errors.New("denied for aws/secret+value"))
+
+			for _, secret := range redact.Secrets(source) {
+				Expect(out.String()).NotTo(ContainSubstring(secret))
+			}
+			Expect(out.String()).NotTo(ContainSubstring(`pass\u003cword\u003e`))
+		})
+
+		It("rejects unknown levels", func() {
+			_, err := logger.FromSource(models.Source{LogLevel: "verbose"})
+			Expect(err).To(MatchError("unknown log level verbose, expected debug, info, warn or error"))
+		})
+	})
+})
@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pivotalservices/pipeline-status-resource/models"
+)
+
+// ContentType is the content type of the Prometheus text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type metric struct {
+	name  string
+	kind  string
+	help  string
+	value func(p models.PipelineSummary, now time.Time) (float64, bool)
+}
+
+var metrics = []metric{
+	{"pipeline_status_build_number", "gauge", "Build number of the status.",
+		func(p models.PipelineSummary, now time.Time) (float64, bool) {
+			build, err := strconv.Atoi(p.BuildNumber)
+			return float64(build), err == nil
+		}},
+	{"pipeline_status_seconds_since_modified", "gauge", "Seconds since the status last changed.",
+		func(p models.PipelineSummary, now time.Time) (float64, bool) {
+			modified, err := time.Parse(models.ISO8601DateFormat, p.LastModified)
+			return now.Sub(modified).Seconds(), err == nil
+		}},
+	{"pipeline_status_run_duration_seconds", "gauge", "Seconds the current run has taken, or the last run took when none is running.",
+		func(p models.PipelineSummary, now time.Time) (float64, bool) {
+			if p.Stats == nil {
+				return 0, false
+			}
+			if started, err := time.Parse(models.ISO8601DateFormat, p.Stats.RunStarted); err == nil {
+				return now.Sub(started).Seconds(), true
+			}
+			return p.Stats.LastRunSeconds, true
+		}},
+	{"pipeline_status_holders", "gauge", "Number of builds holding the status.",
+		func(p models.PipelineSummary, now time.Time) (float64, bool) {
+			return float64(len(p.Holders)), true
+		}},
+	{"pipeline_status_frozen", "gauge", "Whether the status is frozen.",
+		func(p models.PipelineSummary, now time.Time) (float64, bool) {
+			return boolValue(p.Frozen), true
+		}},
+	{"pipeline_status_runs_total", "counter", "Runs started on the status.",
+		func(p models.PipelineSummary, now time.Time) (float64, bool) {
+			return stat(p, func(s *models.StatusStats) float64 { return float64(s.Runs) })
+		}},
+	{"pipeline_status_failures_total", "counter", "Runs that ended with a failure.",
+		func(p models.PipelineSummary, now time.Time) (float64, bool) {
+			return stat(p, func(s *models.StatusStats) float64 { return float64(s.Failures) })
+		}},
+	{"pipeline_status_consecutive_failures", "gauge", "Runs that ended with a failure since the last successful one.",
+		func(p models.PipelineSummary, now time.Time) (float64, bool) {
+			return stat(p, func(s *models.StatusStats) float64 { return float64(s.ConsecutiveFailures) })
+		}},
+	{"pipeline_status_lock_wait_seconds_total", "counter", "Seconds queued builds waited before starting.",
+		func(p models.PipelineSummary, now time.Time) (float64, bool) {
+			return stat(p, func(s *models.StatusStats) float64 { return s.LockWaitSeconds })
+		}},
+	{"pipeline_status_last_lock_wait_seconds", "gauge", "Seconds the last queued build waited before starting.",
+		func(p models.PipelineSummary, now time.Time) (float64, bool) {
+			return stat(p, func(s *models.StatusStats) float64 { return s.LastLockWaitSeconds })
+		}},
+}
+
+// Write writes the statuses in the summary in the Prometheus text format.
+// Every status is labelled with its key, team and pipeline, and its state is
+// reported as pipeline_status_state with a state label set to 1.
+func Write(w io.Writer, summary *models.StatusSummary, now time.Time) error {
+	out := bufio.NewWriter(w)
+
+	header(out, "pipeline_status_state", "gauge", "Current state of the status, as a state label set to 1.")
+	for _, p := range summary.Pipelines {
+		state := p.State
+		if state == "" {
+			state = models.StateReady
+		}
+		fmt.Fprintf(out, "pipeline_status_state{%s,state=\"%s\"} 1\n", labels(p), escape(string(state)))
+	}
+
+	for _, m := range metrics {
+		header(out, m.name, m.kind, m.help)
+		for _, p := range summary.Pipelines {
+			if value, ok := m.value(p, now); ok {
+				fmt.Fprintf(out, "%s{%s} %s\n", m.name, labels(p), strconv.FormatFloat(value, 'g', -1, 64))
+			}
+		}
+	}
+
+	return out.Flush()
+}
+
+func header(w io.Writer, name string, kind string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func labels(p models.PipelineSummary) string {
+	return fmt.Sprintf("key=\"%s\",team=\"%s\",pipeline=\"%s\"", escape(p.Key), escape(p.Team), escape(p.Pipeline))
+}
+
+func escape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func stat(p models.PipelineSummary, value func(*models.StatusStats) float64) (float64, bool) {
+	if p.Stats == nil {
+		return 0, true
+	}
+
+	return value(p.Stats), true
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
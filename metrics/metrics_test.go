@@ -0,0 +1,70 @@
+package metrics_test
+
+import (
+	"bytes"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotalservices/pipeline-status-resource/metrics"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+)
+
+var _ = Describe("Metrics", func() {
+	now := time.Date(2017, 9, 18, 11, 0, 0, 0, time.UTC)
+
+	write := func(summary *models.StatusSummary) string {
+		buf := &bytes.Buffer{}
+		Expect(metrics.Write(buf, summary, now)).To(Succeed())
+		return buf.String()
+	}
+
+	It("reports each status", func() {
+		out := write(&models.StatusSummary{Pipelines: []models.PipelineSummary{{
+			Key:          "status/deploy.yml",
+			Team:         "main",
+			Pipeline:     "deploy",
+			BuildNumber:  "42",
+			State:        models.StateRunning,
+			LastModified: "2017-09-18T10:30:00+0000",
+			Holders:      []models.BuildIdentity{{Team: "main", Pipeline: "deploy"}},
+			Stats: &models.StatusStats{
+				Runs:                42,
+				Failures:            3,
+				ConsecutiveFailures: 1,
+				RunStarted:          "2017-09-18T10:00:00+0000",
+				LockWaitSeconds:     90,
+				LastLockWaitSeconds: 30,
+			},
+		}}})
+
+		labels := `{key="status/deploy.yml",team="main",pipeline="deploy"}`
+		Expect(out).To(ContainSubstring("# TYPE pipeline_status_state gauge\n"))
+		Expect(out).To(ContainSubstring(`pipeline_status_state{key="status/deploy.yml",team="main",pipeline="deploy",state="RUNNING"} 1` + "\n"))
+		Expect(out).To(ContainSubstring("pipeline_status_build_number" + labels + " 42\n"))
+		Expect(out).To(ContainSubstring("pipeline_status_seconds_since_modified" + labels + " 1800\n"))
+		Expect(out).To(ContainSubstring("pipeline_status_run_duration_seconds" + labels + " 3600\n"))
+		Expect(out).To(ContainSubstring("pipeline_status_holders" + labels + " 1\n"))
+		Expect(out).To(ContainSubstring("# TYPE pipeline_status_runs_total counter\n"))
+		Expect(out).To(ContainSubstring("pipeline_status_runs_total" + labels + " 42\n"))
+		Expect(out).To(ContainSubstring("pipeline_status_failures_total" + labels + " 3\n"))
+		Expect(out).To(ContainSubstring("pipeline_status_consecutive_failures" + labels + " 1\n"))
+		Expect(out).To(ContainSubstring("pipeline_status_lock_wait_seconds_total" + labels + " 90\n"))
+		Expect(out).To(ContainSubstring("pipeline_status_last_lock_wait_seconds" + labels + " 30\n"))
+	})
+
+	It("reports the last run duration when nothing is running", func() {
+		out := write(&models.StatusSummary{Pipelines: []models.PipelineSummary{{
+			State: models.StateReady,
+			Stats: &models.StatusStats{LastRunSeconds: 120},
+		}}})
+
+		Expect(out).To(ContainSubstring(`pipeline_status_run_duration_seconds{key="",team="",pipeline=""} 120`))
+	})
+
+	It("escapes label values", func() {
+		out := write(&models.StatusSummary{Pipelines: []models.PipelineSummary{{Pipeline: "a\"b\\c"}}})
+		Expect(out).To(ContainSubstring(`pipeline="a\"b\\c"`))
+		Expect(out).To(ContainSubstring(`state="READY"`))
+	})
+})
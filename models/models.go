@@ -31,7 +31,19 @@ type OutResponse struct {
 }
 
 type OutParams struct {
-	Action StatusAction `json:"action"`
+	Action StatusAction  `json:"action"`
+	State  PipelineState `json:"state"`
+
+	Reason  string `json:"reason"`
+	Expires string `json:"expires"`
+
+	Priority int  `json:"priority"`
+	Force    bool `json:"force"`
+
+	Key       string `json:"key"`
+	Condition string `json:"condition"`
+	Build     string `json:"build"`
+	Timeout   string `json:"timeout"`
 }
 
 type CheckRequest struct {
@@ -43,20 +55,60 @@ type CheckResponse []Version
 
 type Source struct {
 	Debug          string `json:"debug"`
+	LogLevel       string `json:"log_level"`
 	Driver         Driver `json:"driver"`
 	InitialVersion string `json:"initial_version"`
 	RequireReady   bool   `json:"require_ready"`
 	RetryAfter     string `json:"retry_after"`
+	SharedLock     bool   `json:"shared_lock"`
+	Slots          int    `json:"slots"`
+	Queue          bool   `json:"queue"`
+	QueueTimeout   string `json:"queue_timeout"`
+
+	AllowAdminActions bool `json:"allow_admin_actions"`
+	PipelineOwnership bool `json:"pipeline_ownership"`
+
+	States      []PipelineState   `json:"states"`
+	Transitions []StateTransition `json:"transitions"`
+
+	BlackoutWindows []BlackoutWindow `json:"blackout_windows"`
+
+	Keys      []string `json:"keys"`
+	KeyPrefix string   `json:"key_prefix"`
+
+	DependsOn []string `json:"depends_on"`
+
+	Badge    bool   `json:"badge"`
+	BadgeACL string `json:"badge_acl"`
+
+	Notifications []Notification `json:"notifications"`
 
-	Bucket               string `json:"bucket"`
-	Key                  string `json:"key"`
-	AccessKeyID          string `json:"access_key_id"`
-	SecretAccessKey      string `json:"secret_access_key"`
-	RegionName           string `json:"region_name"`
-	Endpoint             string `json:"endpoint"`
-	DisableSSL           bool   `json:"disable_ssl"`
-	ServerSideEncryption string `json:"server_side_encryption"`
-	UseV2Signing         bool   `json:"use_v2_signing"`
+	Bucket                  string            `json:"bucket"`
+	Key                     string            `json:"key"`
+	AccessKeyID             string            `json:"access_key_id"`
+	SecretAccessKey         string            `json:"secret_access_key"`
+	SessionToken            string            `json:"session_token"`
+	RegionName              string            `json:"region_name"`
+	Endpoint                string            `json:"endpoint"`
+	DisableSSL              bool              `json:"disable_ssl"`
+	ServerSideEncryption    string            `json:"server_side_encryption"`
+	SSEKMSKeyID             string            `json:"sse_kms_key_id"`
+	SSEKMSEncryptionContext map[string]string `json:"sse_kms_encryption_context"`
+	SSECustomerKey          string            `json:"sse_customer_key"`
+	UseV2Signing            bool              `json:"use_v2_signing"`
+	Format                  string            `json:"format"`
+
+	CredentialProvider           CredentialProvider `json:"credential_provider"`
+	Profile                      string             `json:"profile"`
+	SharedCredentialsFile        string             `json:"shared_credentials_file"`
+	MetadataEndpoint             string             `json:"metadata_endpoint"`
+	ContainerCredentialsEndpoint string             `json:"container_credentials_endpoint"`
+	WebIdentityTokenFile         string             `json:"web_identity_token_file"`
+	WebIdentityRoleARN           string             `json:"web_identity_role_arn"`
+	AssumeRoleARN                string             `json:"assume_role_arn"`
+	AssumeRoleExternalID         string             `json:"assume_role_external_id"`
+	AssumeRoleSessionName        string             `json:"assume_role_session_name"`
+	STSEndpoint                  string             `json:"sts_endpoint"`
 
 	URI        string `json:"uri"`
 	Branch     string `json:"branch"`
@@ -94,6 +146,27 @@ type OpenStackOptions struct {
 	TokenID          string `json:"token_id"`
 }
 
+// StateTransition declares that a status may move to the state To from any
+// of the states listed in From.
+type StateTransition struct {
+	From []PipelineState `json:"from"`
+	To   PipelineState   `json:"to"`
+}
+
+// BlackoutWindow declares a recurring period during which a pipeline may not
+// start. A window either starts whenever Cron fires and lasts for Duration,
+// or covers the Start to End time of day on the listed Days. Times are
+// evaluated in Timezone, which defaults to UTC.
+type BlackoutWindow struct {
+	Name     string   `json:"name"`
+	Cron     string   `json:"cron"`
+	Duration string   `json:"duration"`
+	Days     []string `json:"days"`
+	Start    string   `json:"start"`
+	End      string   `json:"end"`
+	Timezone string   `json:"timezone"`
+}
+
 type Metadata []MetadataField
 
 type MetadataField struct {
@@ -107,16 +180,124 @@ type BuildFailure struct {
 	DetailsURL string `yaml:"details"`
 }
 
+// BuildIdentity identifies the Concourse build that acted on a status.
+type BuildIdentity struct {
+	Team     string `yaml:"team"`
+	Pipeline string `yaml:"pipeline"`
+	Job      string `yaml:"job"`
+	Build    string `yaml:"build"`
+	ID       string `yaml:"id,omitempty"`
+}
+
+// PipelineFreeze records a maintenance freeze that blocks starts until it is
+// lifted or expires.
+type PipelineFreeze struct {
+	FrozenBy BuildIdentity `yaml:"frozen_by"`
+	FrozenAt string        `yaml:"frozen_at"`
+	Reason   string        `yaml:"reason,omitempty"`
+	Expires  string        `yaml:"expires,omitempty"`
+}
+
+// QueueTicket is a build waiting for its turn to start, stored in an object
+// of its own next to the status. Seen is refreshed each time the waiter
+// polls, so tickets left behind by builds that went away can be dropped.
+// Tickets with a higher Priority go first.
+type QueueTicket struct {
+	Build    BuildIdentity `yaml:"build"`
+	Priority int           `yaml:"priority,omitempty"`
+	Enqueued string        `yaml:"enqueued"`
+	Seen     string        `yaml:"seen"`
+}
+
+// StatusEvent records a change made to a status, such as an administrator
+// forcing it back to READY.
+type StatusEvent struct {
+	Time    string          `yaml:"time"`
+	Action  StatusAction    `yaml:"action"`
+	By      BuildIdentity   `yaml:"by"`
+	From    PipelineState   `yaml:"from,omitempty"`
+	To      PipelineState   `yaml:"to,omitempty"`
+	Holders []BuildIdentity `yaml:"holders,omitempty"`
+	Reason  string          `yaml:"reason,omitempty"`
+}
+
+// PipelineStatus is the document stored for a pipeline. Fields written by a
+// newer schema version than this code knows about are kept in Extra so they
+// survive being rewritten. Queue is only filled in when a status is shown,
+// and is not stored.
 type PipelineStatus struct {
-	Pipeline     string        `yaml:"pipeline"`
-	Team         string        `yaml:"team"`
-	BuildNumber  string        `yaml:"build"`
-	LastModified string        `yaml:"last_modified"`
-	State        PipelineState `yaml:"state"`
-	Failure      *BuildFailure `yaml:"failure,omitempty"`
+	SchemaVersion int             `yaml:"schema_version,omitempty"`
+	Pipeline      string          `yaml:"pipeline"`
+	Team          string          `yaml:"team"`
+	BuildNumber   string          `yaml:"build"`
+	LastModified  string          `yaml:"last_modified"`
+	State         PipelineState   `yaml:"state"`
+	Failure       *BuildFailure   `yaml:"failure,omitempty"`
+	Freeze        *PipelineFreeze `yaml:"freeze,omitempty"`
+	Holder        *BuildIdentity  `yaml:"holder,omitempty"`
+	Holders       []BuildIdentity `yaml:"holders,omitempty"`
+	Queue         []QueueTicket   `yaml:"queue,omitempty"`
+	History       []StatusEvent   `yaml:"history,omitempty"`
+	DependsOn     []string        `yaml:"depends_on,omitempty"`
+	Stats         *StatusStats    `yaml:"stats,omitempty"`
+
+	Extra map[string]interface{} `yaml:",inline"`
+}
+
+// Notification is an endpoint told about the status' state changes.
+type Notification struct {
+	URL         string            `json:"url"`
+	Events      []string          `json:"events"`
+	Body        string            `json:"body"`
+	ContentType string            `json:"content_type"`
+	Headers     map[string]string `json:"headers"`
+	Secret      string            `json:"secret"`
+	Retries     *int              `json:"retries"`
+	RetryDelay  string            `json:"retry_delay"`
+
+	Format        string `json:"format"`
+	LongLockAfter string `json:"long_lock_after"`
+}
+
+// StatusStats are counters kept on a status as it changes state, for
+// reporting as metrics.
+type StatusStats struct {
+	Runs                int     `yaml:"runs"`
+	Failures            int     `yaml:"failures"`
+	ConsecutiveFailures int     `yaml:"consecutive_failures"`
+	RunStarted          string  `yaml:"run_started,omitempty"`
+	LastRunSeconds      float64 `yaml:"last_run_seconds"`
+	LockWaitSeconds     float64 `yaml:"lock_wait_seconds"`
+	LastLockWaitSeconds float64 `yaml:"last_lock_wait_seconds"`
+}
+
+// PipelineSummary is the part of a pipeline's status reported in a
+// StatusSummary.
+type PipelineSummary struct {
+	Key         string        `yaml:"key"`
+	Pipeline    string        `yaml:"pipeline"`
+	Team        string        `yaml:"team"`
+	BuildNumber string        `yaml:"build"`
+	State       PipelineState `yaml:"state"`
+	Failure     *BuildFailure `yaml:"failure,omitempty"`
+	Frozen      bool          `yaml:"frozen,omitempty"`
+
+	LastModified string          `yaml:"last_modified,omitempty"`
+	Holders      []BuildIdentity `yaml:"holders,omitempty"`
+	Stats        *StatusStats    `yaml:"stats,omitempty"`
+}
+
+// StatusSummary combines the statuses stored under several keys.
+type StatusSummary struct {
+	State        PipelineState     `yaml:"state"`
+	BuildNumber  string            `yaml:"build"`
+	LastModified string            `yaml:"last_modified"`
+	Failing      []string          `yaml:"failing,omitempty"`
+	Pipelines    []PipelineSummary `yaml:"pipelines"`
 }
 
 type Driver string
+type CredentialProvider string
 type PipelineState string
 type StatusAction string
 
@@ -128,19 +309,43 @@ const (
 	DriverGCS         Driver = "gcs"
 )
 
+const (
+	CredentialsUnspecified CredentialProvider = ""
+	CredentialsStatic      CredentialProvider = "static"
+	CredentialsAnonymous   CredentialProvider = "anonymous"
+	CredentialsEnv         CredentialProvider = "env"
+	CredentialsProfile     CredentialProvider = "profile"
+	CredentialsEC2         CredentialProvider = "ec2"
+	CredentialsECS         CredentialProvider = "ecs"
+	CredentialsWebIdentity CredentialProvider = "web_identity"
+	CredentialsDefault     CredentialProvider = "default"
+)
+
 const (
 	StateReady   PipelineState = "READY"
 	StateRunning PipelineState = "RUNNING"
+
+	// Overall states of a StatusSummary.
+	StateFailed   PipelineState = "FAILED"
+	StateNotReady PipelineState = "NOT_READY"
 )
 
 const (
-	Start  StatusAction = "start"
-	Finish StatusAction = "finish"
-	Fail   StatusAction = "fail"
+	Start    StatusAction = "start"
+	Finish   StatusAction = "finish"
+	Fail     StatusAction = "fail"
+	SetState StatusAction = "set_state"
+	Freeze   StatusAction = "freeze"
+	Unfreeze StatusAction = "unfreeze"
+
+	ForceReady StatusAction = "force_ready"
+
+	Gate StatusAction = "gate"
 )
 
 const (
-	DefaultRetryPeriod time.Duration = 1 * time.Minute
+	DefaultRetryPeriod  time.Duration = 1 * time.Minute
+	DefaultQueueTimeout time.Duration = 10 * time.Minute
 )
 
 const (
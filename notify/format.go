@@ -0,0 +1,133 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pivotalservices/pipeline-status-resource/models"
+)
+
+// Formatter turns an event into the body a chat service expects.
+type Formatter func(event Event) ([]byte, error)
+
+var formats = map[string]Formatter{
+	"slack": Slack,
+	"teams": Teams,
+}
+
+const (
+	colorGood    = "2eb886"
+	colorWarning = "dfb317"
+	colorDanger  = "e05d44"
+)
+
+// message is the chat agnostic content of an event.
+type message struct {
+	Title string
+	Text  string
+	Link  string
+	Color string
+}
+
+func describe(event Event) message {
+	name := event.Pipeline
+	if name == "" {
+		name = event.Key
+	}
+
+	m := message{Link: event.URL, Color: colorGood}
+
+	switch event.Name {
+	case EventFailed:
+		m.Title = fmt.Sprintf("%s failed", name)
+		m.Color = colorDanger
+		if f := event.Failure; f != nil {
+			m.Text = fmt.Sprintf("Job %s build #%s failed in run #%s.", f.JobName, f.BuildName, event.Build)
+			if f.DetailsURL != "" {
+				m.Link = f.DetailsURL
+			}
+		}
+	case EventLongLock:
+		m.Title = fmt.Sprintf("%s has held the lock for %s", name, event.Held.Round(time.Second))
+		m.Text = fmt.Sprintf("Run #%s is still going.", event.Build)
+		if event.By.Pipeline != "" {
+			m.Text = fmt.Sprintf("Run #%s is still held by %s.", event.Build, describeBuild(event.By))
+		}
+		m.Color = colorWarning
+	default:
+		m.Title = fmt.Sprintf("%s is %s", name, event.To)
+		m.Text = fmt.Sprintf("Run #%s, moved from %s by %s.", event.Build, describeFrom(event.From), describeBuild(event.By))
+		if event.To == models.StateRunning {
+			m.Color = colorWarning
+		}
+	}
+
+	return m
+}
+
+func describeBuild(build models.BuildIdentity) string {
+	if build.Job == "" {
+		return build.Pipeline
+	}
+
+	return fmt.Sprintf("%s/%s #%s", build.Pipeline, build.Job, build.Build)
+}
+
+func describeFrom(state models.PipelineState) string {
+	if state == "" {
+		return "no state"
+	}
+
+	return string(state)
+}
+
+// Slack formats the event for a Slack incoming webhook.
+func Slack(event Event) ([]byte, error) {
+	m := describe(event)
+
+	attachment := map[string]interface{}{
+		"fallback": slackEscape(m.Title),
+		"color":    "#" + m.Color,
+		"title":    slackEscape(m.Title),
+		"text":     slackEscape(m.Text),
+	}
+	if m.Link != "" {
+		attachment["title_link"] = m.Link
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"text":        slackEscape(m.Title),
+		"attachments": []interface{}{attachment},
+	})
+}
+
+// Teams formats the event as a message card for a Microsoft Teams incoming
+// webhook.
+func Teams(event Event) ([]byte, error) {
+	m := describe(event)
+
+	card := map[string]interface{}{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"themeColor": strings.ToUpper(m.Color),
+		"summary":    m.Title,
+		"title":      m.Title,
+		"text":       m.Text,
+	}
+	if m.Link != "" {
+		card["potentialAction"] = []interface{}{map[string]interface{}{
+			"@type":   "OpenUri",
+			"name":    "View build",
+			"targets": []interface{}{map[string]string{"os": "default", "uri": m.Link}},
+		}}
+	}
+
+	return json.Marshal(card)
+}
+
+// slackEscape escapes the characters Slack reserves for links and mentions.
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
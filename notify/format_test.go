@@ -0,0 +1,90 @@
+package notify_test
+
+import (
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/notify"
+)
+
+var _ = Describe("Formatters", func() {
+	var failed, longLock notify.Event
+
+	decode := func(data []byte, err error) map[string]interface{} {
+		Expect(err).NotTo(HaveOccurred())
+
+		var body map[string]interface{}
+		Expect(json.Unmarshal(data, &body)).To(Succeed())
+		return body
+	}
+
+	BeforeEach(func() {
+		failed = notify.Event{
+			Name:     notify.EventFailed,
+			Key:      "status/deploy.yml",
+			Pipeline: "deploy",
+			From:     models.StateRunning,
+			To:       models.StateReady,
+			Build:    "42",
+			Failure:  &models.BuildFailure{JobName: "ship", BuildName: "12", DetailsURL: "https://ci/builds/12"},
+			By:       models.BuildIdentity{Pipeline: "deploy", Job: "ship", Build: "12"},
+			URL:      "https://ci/builds/12",
+		}
+
+		longLock = failed
+		longLock.Name = notify.EventLongLock
+		longLock.Failure = nil
+		longLock.Held = 2*time.Hour + 5*time.Minute + 300*time.Millisecond
+		longLock.URL = "https://ci/builds/13"
+	})
+
+	Describe("Slack", func() {
+		It("links a failure to the failed build", func() {
+			body := decode(notify.Slack(failed))
+			Expect(body["text"]).To(Equal("deploy failed"))
+
+			attachment := body["attachments"].([]interface{})[0].(map[string]interface{})
+			Expect(attachment["title_link"]).To(Equal("https://ci/builds/12"))
+			Expect(attachment["text"]).To(Equal("Job ship build #12 failed in run #42."))
+			Expect(attachment["color"]).To(Equal("#e05d44"))
+		})
+
+		It("says how long the lock has been held", func() {
+			body := decode(notify.Slack(longLock))
+			Expect(body["text"]).To(Equal("deploy has held the lock for 2h5m0s"))
+
+			attachment := body["attachments"].([]interface{})[0].(map[string]interface{})
+			Expect(attachment["title_link"]).To(Equal("https://ci/builds/13"))
+			Expect(attachment["text"]).To(Equal("Run #42 is still held by deploy/ship #12."))
+		})
+
+		It("escapes Slack markup", func() {
+			failed.Pipeline = "<!channel>"
+			body := decode(notify.Slack(failed))
+			Expect(body["text"]).To(Equal("&lt;!channel&gt; failed"))
+		})
+	})
+
+	Describe("Teams", func() {
+		It("sends a message card with a link to the failed build", func() {
+			body := decode(notify.Teams(failed))
+			Expect(body["@type"]).To(Equal("MessageCard"))
+			Expect(body["title"]).To(Equal("deploy failed"))
+			Expect(body["themeColor"]).To(Equal("E05D44"))
+
+			action := body["potentialAction"].([]interface{})[0].(map[string]interface{})
+			target := action["targets"].([]interface{})[0].(map[string]interface{})
+			Expect(target["uri"]).To(Equal("https://ci/builds/12"))
+		})
+
+		It("leaves out the link outside of Concourse", func() {
+			longLock.URL = ""
+			body := decode(notify.Teams(longLock))
+			Expect(body["title"]).To(Equal("deploy has held the lock for 2h5m0s"))
+			Expect(body).NotTo(HaveKey("potentialAction"))
+		})
+	})
+})
@@ -0,0 +1,132 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pivotalservices/pipeline-status-resource/logger"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+)
+
+// Event names, matched against the events a notification is configured
+// for. Moving to any other state is named after the state in lower case.
+// EventLongLock reports how long a run that is still going has held the
+// lock.
+const (
+	EventRunning  = "running"
+	EventReady    = "ready"
+	EventFailed   = "failed"
+	EventLongLock = "long_lock"
+)
+
+// Event is a change of a status' state that has been stored.
+type Event struct {
+	Name     string
+	Key      string
+	Team     string
+	Pipeline string
+	From     models.PipelineState
+	To       models.PipelineState
+	Build    string
+	Failure  *models.BuildFailure
+	By       models.BuildIdentity
+	URL      string
+	Time     string
+
+	// Held is how long a run has held the lock, and HeldBefore how long it
+	// had held it when the previous long lock event was sent.
+	Held       time.Duration
+	HeldBefore time.Duration
+}
+
+// Hook is told about every state change once it has been stored.
+type Hook interface {
+	Notify(event Event) error
+}
+
+// NewEvent describes the change from the previous to the current status,
+// or returns false when the state did not change and no failure was
+// recorded.
+func NewEvent(key string,
+	previous *models.PipelineStatus,
+	current *models.PipelineStatus,
+	by models.BuildIdentity) (Event, bool) {
+
+	from := models.PipelineState("")
+	if previous != nil {
+		from = previous.State
+	}
+
+	event := Event{
+		Key:      key,
+		Team:     current.Team,
+		Pipeline: current.Pipeline,
+		From:     from,
+		To:       current.State,
+		Build:    current.BuildNumber,
+		Failure:  current.Failure,
+		By:       by,
+		Time:     current.LastModified,
+	}
+
+	switch {
+	case current.Failure != nil && (previous == nil || previous.Failure == nil || *previous.Failure != *current.Failure):
+		event.Name = EventFailed
+	case from == current.State:
+		return event, false
+	default:
+		event.Name = strings.ToLower(string(current.State))
+	}
+
+	return event, true
+}
+
+// NewLongLockEvent describes the run of a status that has held the lock for
+// held so far, and had held it for heldBefore when last checked. The event
+// is by the build holding the lock, when one is recorded.
+func NewLongLockEvent(key string, status *models.PipelineStatus, held time.Duration, heldBefore time.Duration) Event {
+	event := Event{
+		Name:       EventLongLock,
+		Key:        key,
+		Team:       status.Team,
+		Pipeline:   status.Pipeline,
+		From:       status.State,
+		To:         status.State,
+		Build:      status.BuildNumber,
+		Time:       status.LastModified,
+		Held:       held,
+		HeldBefore: heldBefore,
+	}
+
+	if status.Holder != nil {
+		event.By = *status.Holder
+	} else if len(status.Holders) > 0 {
+		event.By = status.Holders[0]
+	}
+
+	return event
+}
+
+// FromSource builds a hook for each notification in the source.
+func FromSource(notifications []models.Notification) ([]Hook, error) {
+	hooks := []Hook{}
+	for i, n := range notifications {
+		hook, err := NewWebhook(n)
+		if err != nil {
+			return nil, fmt.Errorf("invalid notification #%d: %s", i+1, err)
+		}
+		hooks = append(hooks, hook)
+	}
+
+	return hooks, nil
+}
+
+// NotifyAll tells every hook about the event. The status has already been
+// stored, so hooks that fail are logged without failing the step.
+func NotifyAll(hooks []Hook, event Event, log *logger.Logger) {
+	for _, hook := range hooks {
+		done := log.Timed("Sent notification", "event", event.Name, "pipeline", event.Pipeline)
+		done(hook.Notify(event))
+	}
+}
@@ -0,0 +1,80 @@
+package notify_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/notify"
+)
+
+var _ = Describe("NewEvent", func() {
+	var (
+		by      models.BuildIdentity
+		ready   *models.PipelineStatus
+		running *models.PipelineStatus
+	)
+
+	BeforeEach(func() {
+		by = models.BuildIdentity{Team: "main", Pipeline: "deploy", Job: "ship", Build: "12"}
+		ready = &models.PipelineStatus{Team: "main", Pipeline: "deploy", BuildNumber: "4", State: models.StateReady}
+		running = &models.PipelineStatus{Team: "main", Pipeline: "deploy", BuildNumber: "5", State: models.StateRunning}
+	})
+
+	It("names the event after the new state", func() {
+		event, ok := notify.NewEvent("deploy.yml", ready, running, by)
+		Expect(ok).To(BeTrue())
+		Expect(event.Name).To(Equal(notify.EventRunning))
+		Expect(event.From).To(Equal(models.StateReady))
+		Expect(event.To).To(Equal(models.StateRunning))
+		Expect(event.Build).To(Equal("5"))
+		Expect(event.By).To(Equal(by))
+
+		event, ok = notify.NewEvent("deploy.yml", running, ready, by)
+		Expect(ok).To(BeTrue())
+		Expect(event.Name).To(Equal(notify.EventReady))
+	})
+
+	It("reports a recorded failure as failed", func() {
+		failed := *ready
+		failed.Failure = &models.BuildFailure{JobName: "ship", BuildName: "12"}
+
+		event, ok := notify.NewEvent("deploy.yml", running, &failed, by)
+		Expect(ok).To(BeTrue())
+		Expect(event.Name).To(Equal(notify.EventFailed))
+		Expect(event.Failure).To(Equal(failed.Failure))
+	})
+
+	It("ignores changes that keep the state and failure", func() {
+		_, ok := notify.NewEvent("deploy.yml", running, running, by)
+		Expect(ok).To(BeFalse())
+
+		failed := *ready
+		failed.Failure = &models.BuildFailure{JobName: "ship", BuildName: "12"}
+		again := failed
+		again.Failure = &models.BuildFailure{JobName: "ship", BuildName: "12"}
+		_, ok = notify.NewEvent("deploy.yml", &failed, &again, by)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("names custom states in lower case", func() {
+		deploying := *running
+		deploying.State = "DEPLOYING"
+
+		event, ok := notify.NewEvent("deploy.yml", running, &deploying, by)
+		Expect(ok).To(BeTrue())
+		Expect(event.Name).To(Equal("deploying"))
+	})
+
+	It("describes how long a run has held the lock", func() {
+		running.Holder = &by
+
+		event := notify.NewLongLockEvent("deploy.yml", running, 2*time.Hour, time.Hour)
+		Expect(event.Name).To(Equal(notify.EventLongLock))
+		Expect(event.To).To(Equal(models.StateRunning))
+		Expect(event.By).To(Equal(by))
+		Expect(event.Held).To(Equal(2 * time.Hour))
+		Expect(event.HeldBefore).To(Equal(time.Hour))
+	})
+})
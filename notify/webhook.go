@@ -0,0 +1,314 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pivotalservices/pipeline-status-resource/models"
+)
+
+// SignatureHeader carries the HMAC-SHA256 of the body, keyed with the
+// notification's secret, as "sha256=<hex>".
+const SignatureHeader = "X-Pipeline-Status-Signature"
+
+// EventHeader carries the name of the event being sent.
+const EventHeader = "X-Pipeline-Status-Event"
+
+const (
+	defaultRetries    = 3
+	defaultRetryDelay = time.Second
+	defaultTimeout    = 10 * time.Second
+)
+
+// Webhook posts events to a URL, as JSON, formatted for a chat service or
+// rendered from a template.
+type Webhook struct {
+	URL           string
+	Events        []string
+	LongLockAfter time.Duration
+	Body          *template.Template
+	Format        Formatter
+	ContentType   string
+	Headers       map[string]string
+	Secret        string
+	Retries       int
+	RetryDelay    time.Duration
+	Client        *http.Client
+}
+
+// Payload is what is sent for an event when no body template is given, and
+// what a body template is rendered with.
+type Payload struct {
+	Event    string          `json:"event"`
+	Key      string          `json:"key"`
+	Team     string          `json:"team"`
+	Pipeline string          `json:"pipeline"`
+	From     string          `json:"from"`
+	To       string          `json:"to"`
+	Build    string          `json:"build"`
+	Failure  *PayloadFailure `json:"failure,omitempty"`
+	By       PayloadBuild    `json:"by"`
+	URL      string          `json:"url,omitempty"`
+	Held     float64         `json:"held_seconds,omitempty"`
+	Time     string          `json:"time"`
+}
+
+// PayloadFailure describes the build that failed.
+type PayloadFailure struct {
+	Job     string `json:"job"`
+	Build   string `json:"build"`
+	Details string `json:"details"`
+}
+
+// PayloadBuild identifies the build that caused the event.
+type PayloadBuild struct {
+	Team     string `json:"team"`
+	Pipeline string `json:"pipeline"`
+	Job      string `json:"job"`
+	Build    string `json:"build"`
+}
+
+// NewWebhook validates a notification and parses its body template.
+func NewWebhook(n models.Notification) (*Webhook, error) {
+	if n.URL == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+	// Chat services put their tokens in the url, so it is left out of
+	// errors.
+	if u, err := url.Parse(n.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("url must be an http or https URL")
+	}
+
+	hook := &Webhook{
+		URL:         n.URL,
+		ContentType: n.ContentType,
+		Headers:     n.Headers,
+		Secret:      n.Secret,
+		Retries:     defaultRetries,
+		RetryDelay:  defaultRetryDelay,
+		Client:      &http.Client{Timeout: defaultTimeout},
+	}
+
+	for _, event := range n.Events {
+		hook.Events = append(hook.Events, strings.ToLower(event))
+	}
+
+	if n.Retries != nil {
+		if *n.Retries < 0 {
+			return nil, fmt.Errorf("retries cannot be negative")
+		}
+		hook.Retries = *n.Retries
+	}
+
+	if n.RetryDelay != "" {
+		delay, err := time.ParseDuration(n.RetryDelay)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retry_delay: %s", err)
+		}
+		hook.RetryDelay = delay
+	}
+
+	if n.LongLockAfter != "" {
+		after, err := time.ParseDuration(n.LongLockAfter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid long_lock_after: %s", err)
+		}
+		hook.LongLockAfter = after
+	}
+
+	if n.Format != "" {
+		if n.Body != "" {
+			return nil, fmt.Errorf("format cannot be combined with body")
+		}
+
+		format, ok := formats[n.Format]
+		if !ok {
+			return nil, fmt.Errorf("unknown format %s, expected slack or teams", n.Format)
+		}
+		hook.Format = format
+	}
+
+	if n.Body != "" {
+		body, err := template.New("body").Funcs(template.FuncMap{"json": toJSON}).Parse(n.Body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body: %s", err)
+		}
+		hook.Body = body
+	}
+
+	if hook.ContentType == "" {
+		hook.ContentType = "application/json"
+	}
+
+	return hook, nil
+}
+
+// Wants reports whether the webhook is configured for the event. Webhooks
+// without events want every event, but long lock events are only sent once
+// per run, when the run passes long_lock_after.
+func (hook *Webhook) Wants(event Event) bool {
+	if event.Name == EventLongLock && (hook.LongLockAfter <= 0 ||
+		event.Held < hook.LongLockAfter || event.HeldBefore >= hook.LongLockAfter) {
+		return false
+	}
+
+	if len(hook.Events) == 0 {
+		return true
+	}
+
+	for _, name := range hook.Events {
+		if name == event.Name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Notify sends the event, retrying server errors and failed connections.
+func (hook *Webhook) Notify(event Event) error {
+	if !hook.Wants(event) {
+		return nil
+	}
+
+	body, err := hook.render(event)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		retry, err := hook.send(event, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= hook.Retries {
+			return err
+		}
+
+		time.Sleep(hook.RetryDelay)
+	}
+}
+
+func (hook *Webhook) render(event Event) ([]byte, error) {
+	if hook.Format != nil {
+		return hook.Format(event)
+	}
+
+	payload := NewPayload(event)
+	if hook.Body == nil {
+		return json.Marshal(payload)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := hook.Body.Execute(buf, payload); err != nil {
+		return nil, fmt.Errorf("Cannot render body: %s", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// send posts the body once, reporting whether a failure is worth retrying.
+func (hook *Webhook) send(event Event, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("Cannot build request to %s", hook.host())
+	}
+
+	req.Header.Set("Content-Type", hook.ContentType)
+	req.Header.Set(EventHeader, event.Name)
+	for name, value := range hook.Headers {
+		req.Header.Set(name, value)
+	}
+	if hook.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(hook.Secret, body))
+	}
+
+	client := hook.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return true, fmt.Errorf("Cannot reach %s: %s", hook.host(), err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests,
+			fmt.Errorf("%s responded with %s", hook.host(), resp.Status)
+	}
+
+	return false, nil
+}
+
+// host names the webhook in errors and logs without the path and query
+// that may hold its token.
+func (hook *Webhook) host() string {
+	u, err := url.Parse(hook.URL)
+	if err != nil {
+		return "webhook"
+	}
+
+	return u.Host
+}
+
+// Sign returns the signature of the body sent in SignatureHeader.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewPayload describes the event with JSON field names.
+func NewPayload(event Event) Payload {
+	payload := Payload{
+		Event:    event.Name,
+		Key:      event.Key,
+		Team:     event.Team,
+		Pipeline: event.Pipeline,
+		From:     string(event.From),
+		To:       string(event.To),
+		Build:    event.Build,
+		By: PayloadBuild{
+			Team:     event.By.Team,
+			Pipeline: event.By.Pipeline,
+			Job:      event.By.Job,
+			Build:    event.By.Build,
+		},
+		URL:  event.URL,
+		Held: event.Held.Seconds(),
+		Time: event.Time,
+	}
+
+	if event.Failure != nil {
+		payload.Failure = &PayloadFailure{
+			Job:     event.Failure.JobName,
+			Build:   event.Failure.BuildName,
+			Details: event.Failure.DetailsURL,
+		}
+	}
+
+	return payload
+}
+
+// toJSON quotes a value for use inside a JSON body template.
+func toJSON(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	return string(data), err
+}
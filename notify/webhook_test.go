@@ -0,0 +1,223 @@
+package notify_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/notify"
+)
+
+type request struct {
+	header http.Header
+	body   string
+}
+
+var _ = Describe("Webhook", func() {
+	var (
+		server   *httptest.Server
+		lock     sync.Mutex
+		requests []request
+		statuses []int
+		event    notify.Event
+	)
+
+	received := func() []request {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]request{}, requests...)
+	}
+
+	webhook := func(n models.Notification) *notify.Webhook {
+		n.URL = server.URL
+		if n.RetryDelay == "" {
+			n.RetryDelay = "1ms"
+		}
+
+		hook, err := notify.NewWebhook(n)
+		Expect(err).NotTo(HaveOccurred())
+		return hook
+	}
+
+	BeforeEach(func() {
+		requests, statuses = nil, nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+
+			lock.Lock()
+			defer lock.Unlock()
+			requests = append(requests, request{header: r.Header, body: string(body)})
+			if len(statuses) > 0 {
+				w.WriteHeader(statuses[0])
+				statuses = statuses[1:]
+			}
+		}))
+
+		event = notify.Event{
+			Name:     notify.EventFailed,
+			Key:      "status/deploy.yml",
+			Team:     "main",
+			Pipeline: "deploy",
+			From:     models.StateRunning,
+			To:       models.StateReady,
+			Build:    "5",
+			Failure:  &models.BuildFailure{JobName: "ship", BuildName: "12", DetailsURL: "https://ci/builds/12"},
+			By:       models.BuildIdentity{Team: "main", Pipeline: "deploy", Job: "ship", Build: "12"},
+			Time:     "2017-09-18T10:00:00+0000",
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("posts the event as JSON", func() {
+		Expect(webhook(models.Notification{}).Notify(event)).To(Succeed())
+
+		Expect(received()).To(HaveLen(1))
+		r := received()[0]
+		Expect(r.header.Get("Content-Type")).To(Equal("application/json"))
+		Expect(r.header.Get(notify.EventHeader)).To(Equal("failed"))
+		Expect(r.header.Get(notify.SignatureHeader)).To(BeEmpty())
+
+		var payload notify.Payload
+		Expect(json.Unmarshal([]byte(r.body), &payload)).To(Succeed())
+		Expect(payload.Event).To(Equal("failed"))
+		Expect(payload.Key).To(Equal("status/deploy.yml"))
+		Expect(payload.From).To(Equal("RUNNING"))
+		Expect(payload.To).To(Equal("READY"))
+		Expect(payload.Failure.Details).To(Equal("https://ci/builds/12"))
+		Expect(payload.By.Job).To(Equal("ship"))
+	})
+
+	It("renders the body template", func() {
+		hook := webhook(models.Notification{
+			Body:        `{"text": {{json (printf "%s failed in %s #%s" .Pipeline .Failure.Job .Failure.Build)}}}`,
+			ContentType: "application/vnd.chat+json",
+			Headers:     map[string]string{"Authorization": "Bearer token"},
+		})
+		Expect(hook.Notify(event)).To(Succeed())
+
+		r := received()[0]
+		Expect(r.body).To(Equal(`{"text": "deploy failed in ship #12"}`))
+		Expect(r.header.Get("Content-Type")).To(Equal("application/vnd.chat+json"))
+		Expect(r.header.Get("Authorization")).To(Equal("Bearer token"))
+	})
+
+	It("signs the body with the secret", func() {
+		Expect(webhook(models.Notification{Secret: "s3cr3t"}).Notify(event)).To(Succeed())
+
+		r := received()[0]
+		Expect(r.header.Get(notify.SignatureHeader)).To(Equal(notify.Sign("s3cr3t", []byte(r.body))))
+		Expect(r.header.Get(notify.SignatureHeader)).To(HavePrefix("sha256="))
+	})
+
+	It("only sends the configured events", func() {
+		hook := webhook(models.Notification{Events: []string{"RUNNING"}})
+		Expect(hook.Notify(event)).To(Succeed())
+		Expect(received()).To(BeEmpty())
+
+		event.Name = notify.EventRunning
+		Expect(hook.Notify(event)).To(Succeed())
+		Expect(received()).To(HaveLen(1))
+	})
+
+	It("sends long lock events once, when the run passes long_lock_after", func() {
+		event.Name = notify.EventLongLock
+		event.Held = 30 * time.Minute
+
+		Expect(webhook(models.Notification{}).Notify(event)).To(Succeed())
+		Expect(received()).To(BeEmpty())
+
+		hook := webhook(models.Notification{LongLockAfter: "1h"})
+		Expect(hook.Notify(event)).To(Succeed())
+		Expect(received()).To(BeEmpty())
+
+		event.HeldBefore, event.Held = event.Held, 2*time.Hour
+		Expect(hook.Notify(event)).To(Succeed())
+		Expect(received()).To(HaveLen(1))
+
+		event.HeldBefore, event.Held = event.Held, 3*time.Hour
+		Expect(hook.Notify(event)).To(Succeed())
+		Expect(received()).To(HaveLen(1))
+	})
+
+	It("formats events for chat services", func() {
+		Expect(webhook(models.Notification{Format: "slack"}).Notify(event)).To(Succeed())
+
+		body, err := notify.Slack(event)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(received()[0].body).To(Equal(string(body)))
+	})
+
+	It("retries server errors", func() {
+		statuses = []int{http.StatusBadGateway, http.StatusServiceUnavailable}
+
+		Expect(webhook(models.Notification{}).Notify(event)).To(Succeed())
+		Expect(received()).To(HaveLen(3))
+	})
+
+	It("gives up after the configured retries", func() {
+		retries := 1
+		statuses = []int{500, 500, 500}
+
+		err := webhook(models.Notification{Retries: &retries}).Notify(event)
+		Expect(err).To(MatchError(ContainSubstring("500")))
+		Expect(received()).To(HaveLen(2))
+	})
+
+	It("leaves the url's token out of errors", func() {
+		retries := 0
+		hook, err := notify.NewWebhook(models.Notification{
+			URL:     server.URL + "/services/T000/B000/XXXXSECRETXXXX",
+			Retries: &retries,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		statuses = []int{http.StatusNotFound}
+		err = hook.Notify(event)
+		Expect(err).To(MatchError(strings.TrimPrefix(server.URL, "http://") + " responded with 404 Not Found"))
+
+		server.Close()
+		err = hook.Notify(event)
+		Expect(err).To(MatchError(HavePrefix("Cannot reach " + strings.TrimPrefix(server.URL, "http://"))))
+		Expect(err.Error()).NotTo(ContainSubstring("SECRET"))
+
+		_, err = notify.NewWebhook(models.Notification{URL: "ftp://hooks.slack.com/services/XXXXSECRETXXXX"})
+		Expect(err).To(MatchError("url must be an http or https URL"))
+	})
+
+	It("does not retry client errors", func() {
+		statuses = []int{http.StatusBadRequest}
+
+		Expect(webhook(models.Notification{}).Notify(event)).NotTo(Succeed())
+		Expect(received()).To(HaveLen(1))
+	})
+
+	It("validates the notification", func() {
+		retries := -1
+		for _, n := range []models.Notification{
+			{},
+			{URL: "ftp://hooks"},
+			{URL: "https://hooks", Body: "{{.Nope"},
+			{URL: "https://hooks", RetryDelay: "soon"},
+			{URL: "https://hooks", Retries: &retries},
+			{URL: "https://hooks", Format: "irc"},
+			{URL: "https://hooks", Format: "slack", Body: "{}"},
+			{URL: "https://hooks", LongLockAfter: "a while"},
+		} {
+			_, err := notify.NewWebhook(n)
+			Expect(err).To(HaveOccurred())
+		}
+
+		_, err := notify.FromSource([]models.Notification{{URL: "https://hooks"}, {}})
+		Expect(err).To(MatchError(ContainSubstring("notification #2")))
+	})
+})
@@ -3,19 +3,24 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"time"
 
+	"github.com/pivotalservices/pipeline-status-resource/blackout"
 	"github.com/pivotalservices/pipeline-status-resource/driver"
+	"github.com/pivotalservices/pipeline-status-resource/logger"
 	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/redact"
+	"github.com/pivotalservices/pipeline-status-resource/state"
 )
 
 var VERSION = "local-build"
 
+var log = logger.Default
+
 func main() {
 	if len(os.Args) < 2 {
-		println("usage: " + os.Args[0] + " <source>")
+		log.Error("usage: " + os.Args[0] + " <source>")
 		os.Exit(1)
 	}
 
@@ -27,17 +32,11 @@ func main() {
 		fatal("reading request", err)
 	}
 
-	debug := driver.IsDebug(request.Source)
-
-	if debug {
-		if tmpFile, err := ioutil.TempFile("/tmp", "outdbg"); err == nil {
-			json.NewEncoder(tmpFile).Encode(request)
-		} else {
-			fmt.Fprintf(os.Stderr, "Error writing debug output: %v\n", err)
-		}
-	}
+	// An invalid log_level is reported when the driver is constructed.
+	log, _ = logger.FromSource(request.Source)
+	log.Debug("Received request", "request", redact.Request(request))
 
-	driver, err := driver.FromSource(request.Source)
+	d, err := driver.FromSource(request.Source)
 	if err != nil {
 		fatal("constructing driver", err)
 	}
@@ -46,48 +45,119 @@ func main() {
 
 	switch request.Params.Action {
 	case models.Start:
-		ok, err := driver.Load(status)
+		var ok bool
+		ok, err = d.Load(status)
 		if !ok && err != nil {
 			fatal("fetching status", err)
 		}
 
 		if request.Source.RequireReady {
-			retryDuration, err := time.ParseDuration(request.Source.RetryAfter)
+			retryDuration := driver.RetryPeriod(request.Source)
+
+			blackouts, err := blackout.FromSource(request.Source.BlackoutWindows)
 			if err != nil {
-				retryDuration = models.DefaultRetryPeriod
+				fatal("reading blackout windows", err)
+			}
+
+			log.Info("Pipeline is currently in "+string(status.State)+" state", "state", status.State)
+			if status.State == models.StateRunning && status.Holder != nil {
+				log.Info("Pipeline is held", "holder", state.DescribeBuild(*status.Holder))
+			}
+			for _, holder := range status.Holders {
+				log.Info("Slot is held", "holder", state.DescribeBuild(holder))
+			}
+			if state.IsFrozen(status, time.Now()) {
+				log.Info("Pipeline is frozen", "freeze", state.DescribeFreeze(status.Freeze))
+			}
+			if window, ends, active := blackouts.Active(time.Now()); active {
+				log.Info("Pipeline is in a blackout window", "window", window.Describe(),
+					"ends", ends.Format(models.ISO8601DateFormat))
 			}
 
-			fmt.Fprintf(os.Stderr, "Pipeline is currently in %s state\n", status.State)
+			enqueued := time.Now()
+			recordWait(d, enqueued)
+			lastAhead := -1
+			lastBlockedBy := ""
 			for {
-				if status.State == models.StateReady || status.State == "" {
+				ahead := 0
+				if request.Source.Queue || request.Params.Priority != 0 {
+					ahead, err = d.Enqueue(enqueued, request.Params.Priority)
+					if err != nil {
+						fatal("queueing for pipeline", err)
+					}
+
+					if ahead != lastAhead && ahead > 0 {
+						log.Info("Builds are waiting ahead of this one", "ahead", ahead)
+					}
+					lastAhead = ahead
+				}
+
+				_, _, blackedOut := blackouts.Active(time.Now())
+				ready := status.State == models.StateReady || status.State == ""
+				if request.Source.Slots > 0 {
+					ready = state.HasFreeSlot(status, request.Source.Slots)
+				}
+				if summarizer, ok := d.(driver.Summarizer); ok {
+					if ready, err = summarizer.Ready(); err != nil {
+						fatal("fetching status", err)
+					}
+				}
+
+				blockedBy, err := driver.DescribeBlockingDependency(d)
+				if err != nil {
+					fatal("resolving dependencies", err)
+				}
+				if blockedBy != lastBlockedBy && blockedBy != "" {
+					log.Info("Pipeline is blocked by a dependency", "blocked_by", blockedBy)
+				}
+				lastBlockedBy = blockedBy
+
+				if ready && ahead == 0 && !state.IsFrozen(status, time.Now()) && !blackedOut && blockedBy == "" {
 					break
 				}
 
-				fmt.Fprint(os.Stderr, ".")
+				log.Debug("Waiting for pipeline", "state", status.State, "retry_after", retryDuration)
 				time.Sleep(retryDuration)
 
-				ok, err = driver.Load(status)
+				*status = models.PipelineStatus{}
+				ok, err = d.Load(status)
 				if !ok && err != nil {
 					fatal("fetching status", err)
 				}
 			}
 		}
 
-		status, err = driver.Start()
+		status, err = d.Start()
 	case models.Finish:
-		status, err = driver.Finish()
+		status, err = d.Finish(request.Params.Force)
 	case models.Fail:
-		status, err = driver.Fail()
+		status, err = d.Fail(request.Params.Force)
+	case models.SetState:
+		if request.Params.State == "" {
+			fatal("setting pipeline state", fmt.Errorf("the state param is required for the %s action", models.SetState))
+		}
+		status, err = d.SetState(request.Params.State)
+	case models.Freeze:
+		expires, parseErr := parseExpiry(request.Params.Expires)
+		if parseErr != nil {
+			fatal("freezing pipeline", parseErr)
+		}
+		status, err = d.Freeze(request.Params.Reason, expires)
+	case models.Unfreeze:
+		status, err = d.Unfreeze()
+	case models.ForceReady:
+		status, err = d.ForceReady(request.Params.Reason)
+	case models.Gate:
+		status, err = gate(d, request.Source, request.Params)
+	default:
+		fatal("reading request", fmt.Errorf("unknown action: %s", request.Params.Action))
 	}
 
 	if err != nil {
-		fatal(fmt.Sprintf("%sing pipeline", request.Params.Action), err)
+		fatal(fmt.Sprintf("running %s action", request.Params.Action), err)
 	}
 
-	if debug {
-		fmt.Fprintf(os.Stderr, "Status: %v\n", status)
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-	}
+	log.Debug("Ran action", "action", request.Params.Action, "build", status.BuildNumber, "state", status.State)
 
 	json.NewEncoder(os.Stdout).Encode(models.OutResponse{
 		Version: models.Version{
@@ -99,7 +169,105 @@ func main() {
 	})
 }
 
+// gate waits until the status stored under the key in the params meets the
+// gate's condition, failing once the timeout has passed. Without a timeout
+// the condition is checked once. The pipeline's own status is only read.
+func gate(own driver.Driver, source models.Source, params models.OutParams) (*models.PipelineStatus, error) {
+	if params.Key == "" {
+		return nil, fmt.Errorf("the key param is required for the %s action", models.Gate)
+	}
+
+	condition, err := state.NewGate(state.GateCondition(params.Condition), params.Build)
+	if err != nil {
+		return nil, err
+	}
+
+	var timeout time.Duration
+	if params.Timeout != "" {
+		if timeout, err = time.ParseDuration(params.Timeout); err != nil {
+			return nil, fmt.Errorf("invalid timeout: %s", err)
+		}
+	}
+
+	gateSource := source
+	gateSource.Key = params.Key
+	gateSource.Keys = nil
+	gateSource.KeyPrefix = ""
+
+	upstream, err := driver.FromSource(gateSource)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	lastReason := ""
+	for {
+		other := &models.PipelineStatus{}
+		ok, err := upstream.Load(other)
+		if !ok {
+			return nil, err
+		}
+
+		reason, blocked := condition.Blocked(other)
+		if err != nil {
+			reason, blocked = fmt.Sprintf("no status is stored at %s", params.Key), true
+		}
+
+		if !blocked {
+			break
+		}
+
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("Gate on %s is blocked, %s", params.Key, reason)
+		}
+
+		if reason != lastReason {
+			log.Info("Waiting for gate", "key", params.Key, "reason", reason)
+			lastReason = reason
+		}
+		time.Sleep(driver.RetryPeriod(source))
+	}
+
+	status := &models.PipelineStatus{}
+	if ok, err := own.Load(status); !ok {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// parseExpiry accepts either a duration relative to now (e.g. 4h) or an
+// absolute timestamp. An empty value means the freeze never expires.
+func parseExpiry(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(d), nil
+	}
+
+	if t, err := time.Parse(models.ISO8601DateFormat, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expires %q, expected a duration or a timestamp", value)
+	}
+
+	return t, nil
+}
+
+// recordWait tells drivers that measure lock waits when the build started
+// waiting to start.
+func recordWait(d driver.Driver, since time.Time) {
+	if waiter, ok := d.(driver.Waiter); ok {
+		waiter.SetWaitStart(since)
+	}
+}
+
 func fatal(doing string, err error) {
-	println("error " + doing + ": " + err.Error())
+	log.Error("error "+doing, "error", err)
 	os.Exit(1)
 }
@@ -210,6 +210,42 @@ state: %s
 				})
 			})
 
+			Context("with several keys, one of which failed", func() {
+				var otherKey string
+
+				BeforeEach(func() {
+					otherKey = key + "-other"
+					request.Source.Key = ""
+					request.Source.Keys = []string{key, otherKey}
+					request.Source.RequireReady = true
+					request.Source.RetryAfter = "1s"
+
+					putStatus("3", models.StateReady)
+					failed := fmt.Sprintf(yamlTemplate, "4", time.Now().Format(models.ISO8601DateFormat), models.StateReady) +
+						"failure: {job: deploy, build: \"4\"}\n"
+					_, err := svc.PutObject(&s3.PutObjectInput{
+						Bucket: aws.String(bucketName),
+						Key:    aws.String(otherKey),
+						Body:   strings.NewReader(failed),
+					})
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				AfterEach(func() {
+					_, err := svc.DeleteObject(&s3.DeleteObjectInput{
+						Bucket: aws.String(bucketName),
+						Key:    aws.String(otherKey),
+					})
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("starts every key instead of waiting for the failure to clear", func() {
+					status := getStatus()
+					Expect(status.State).Should(Equal(models.StateRunning))
+					Expect(status.BuildNumber).Should(Equal("4"))
+				})
+			})
+
 			Context("subsequent times", func() {
 				Context("when the state is currently running", func() {
 					var timestamp string
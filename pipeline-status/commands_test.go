@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/adammck/venv"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/pivotalservices/pipeline-status-resource/driver"
+	"github.com/pivotalservices/pipeline-status-resource/logger"
+)
+
+var _ = Describe("commands", func() {
+	var (
+		d      *driver.S3Driver
+		opts   *options
+		stdout *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		d = &driver.S3Driver{
+			Env:               venv.OS(),
+			Svc:               driver.NewMemoryServicer(nil),
+			BucketName:        "statuses",
+			Key:               "status.yml",
+			AllowAdminActions: true,
+			Log:               logger.New(GinkgoWriter, logger.Info),
+		}
+		opts = &options{output: "table", team: "main", pipeline: "deploy", job: "pipeline-status"}
+		stdout = &bytes.Buffer{}
+	})
+
+	runCommand := func(command string) error {
+		stdout.Reset()
+		return run(d, opts, command, stdout, nil)
+	}
+
+	decode := func() map[string]interface{} {
+		decoded := map[string]interface{}{}
+		Expect(json.Unmarshal(stdout.Bytes(), &decoded)).To(Succeed())
+		return decoded
+	}
+
+	It("starts and finishes a run", func() {
+		Expect(runCommand("start")).To(Succeed())
+		Expect(stdout.String()).To(MatchRegexp(`pipeline\s+deploy`))
+		Expect(stdout.String()).To(MatchRegexp(`state\s+RUNNING`))
+		Expect(stdout.String()).To(MatchRegexp(`holder\s+main/deploy/pipeline-status`))
+
+		Expect(runCommand("finish")).To(Succeed())
+		Expect(stdout.String()).To(MatchRegexp(`state\s+READY`))
+	})
+
+	It("records the failing job without touching the environment", func() {
+		Expect(runCommand("start")).To(Succeed())
+		Expect(runCommand("fail")).To(Succeed())
+
+		status, err := load(d)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Failure.JobName).To(Equal("pipeline-status"))
+		Expect(os.Getenv("BUILD_PIPELINE_NAME")).To(BeEmpty())
+	})
+
+	It("needs a team and pipeline to finish a run", func() {
+		Expect(runCommand("start")).To(Succeed())
+
+		opts.team, opts.pipeline = "", ""
+		Expect(runCommand("finish")).To(MatchError("finish needs -team and -pipeline"))
+	})
+
+	It("does not finish another pipeline's run", func() {
+		Expect(runCommand("start")).To(Succeed())
+
+		opts.pipeline = "other"
+		err := runCommand("finish")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("it was started by main/deploy/pipeline-status"))
+	})
+
+	It("gets the status", func() {
+		Expect(runCommand("start")).To(Succeed())
+
+		Expect(runCommand("get")).To(Succeed())
+		Expect(stdout.String()).To(MatchRegexp(`team\s+main`))
+		Expect(stdout.String()).To(MatchRegexp(`state\s+RUNNING`))
+
+		opts.output = "json"
+		Expect(runCommand("get")).To(Succeed())
+		status := decode()
+		Expect(status["pipeline"]).To(Equal("deploy"))
+		Expect(status["state"]).To(Equal("RUNNING"))
+	})
+
+	It("resets the status as the given team and pipeline", func() {
+		Expect(runCommand("start")).To(Succeed())
+
+		opts.team, opts.pipeline, opts.reason = "", "", "worker died"
+		Expect(runCommand("reset")).To(MatchError("reset needs -team and -pipeline"))
+
+		opts.team, opts.pipeline = "ops", "admin"
+		Expect(runCommand("reset")).To(Succeed())
+		Expect(stdout.String()).To(MatchRegexp(`state\s+READY`))
+		Expect(stdout.String()).NotTo(ContainSubstring("holder"))
+	})
+
+	It("shows the history along with who acted", func() {
+		Expect(runCommand("start")).To(Succeed())
+		opts.reason, opts.by = "worker died", "alice"
+		Expect(runCommand("reset")).To(Succeed())
+
+		Expect(runCommand("history")).To(Succeed())
+		Expect(stdout.String()).To(MatchRegexp(`TIME\s+ACTION\s+BY\s+FROM\s+TO\s+REASON`))
+		Expect(stdout.String()).To(MatchRegexp(`force_ready\s+main/deploy/pipeline-status #alice\s+RUNNING\s+READY\s+worker died`))
+
+		opts.output = "json"
+		Expect(runCommand("history")).To(Succeed())
+		history := decode()["history"].([]interface{})
+		Expect(history).To(HaveLen(1))
+		Expect(history[0].(map[string]interface{})["action"]).To(Equal("force_ready"))
+		Expect(history[0].(map[string]interface{})["reason"]).To(Equal("worker died"))
+	})
+
+	It("does not reset without admin actions", func() {
+		Expect(runCommand("start")).To(Succeed())
+
+		d.AllowAdminActions = false
+		opts.reason = "worker died"
+		Expect(runCommand("reset")).To(MatchError("The force_ready action requires allow_admin_actions to be set on the source"))
+	})
+
+	It("lists the statuses under a prefix", func() {
+		d.Key = "status/a.yml"
+		Expect(runCommand("start")).To(Succeed())
+		d.Key = "status/b.yml"
+		opts.pipeline = "test"
+		Expect(runCommand("start")).To(Succeed())
+		Expect(runCommand("finish")).To(Succeed())
+
+		aggregate := &driver.AggregateDriver{Base: *d, Prefix: "status/"}
+		stdout.Reset()
+		Expect(run(aggregate, opts, "list", stdout, nil)).To(Succeed())
+		Expect(stdout.String()).To(MatchRegexp(`KEY\s+TEAM\s+PIPELINE\s+BUILD\s+STATE\s+FAILURE`))
+		Expect(stdout.String()).To(MatchRegexp(`status/a.yml\s+main\s+deploy\s+\S+\s+RUNNING`))
+		Expect(stdout.String()).To(MatchRegexp(`status/b.yml\s+main\s+test\s+\S+\s+READY`))
+
+		opts.output = "json"
+		stdout.Reset()
+		Expect(run(aggregate, opts, "list", stdout, nil)).To(Succeed())
+		summary := decode()
+		Expect(summary["state"]).To(Equal("RUNNING"))
+		Expect(summary["pipelines"]).To(HaveLen(2))
+	})
+
+	It("shows each change while watching", func() {
+		Expect(runCommand("start")).To(Succeed())
+
+		watched := gbytes.NewBuffer()
+		stop := make(chan struct{})
+		done := make(chan error)
+		opts.interval = 10 * time.Millisecond
+		opts.output = "json"
+		go func() {
+			done <- run(d, opts, "watch", watched, stop)
+		}()
+
+		Eventually(watched).Should(gbytes.Say(`"state":"RUNNING"`))
+		Expect(runCommand("finish")).To(Succeed())
+		Eventually(watched).Should(gbytes.Say(`"state":"READY"`))
+
+		close(stop)
+		Eventually(done).Should(Receive(BeNil()))
+	})
+})
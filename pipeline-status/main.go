@@ -0,0 +1,301 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/adammck/venv"
+	"github.com/pivotalservices/pipeline-status-resource/driver"
+	"github.com/pivotalservices/pipeline-status-resource/logger"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+)
+
+var VERSION = "local-build"
+
+var log = logger.Default
+
+const usage = `usage: pipeline-status [flags] <command>
+
+Inspects and manages the statuses kept by the pipeline status resource,
+using the same source configuration as the pipelines.
+
+commands:
+  get       show the status
+  list      show every status under the source's keys or key_prefix
+  history   show the recorded history of the status
+  start     start a run, requires -team and -pipeline
+  finish    finish the run, requires -team and -pipeline
+  fail      fail the run, requires -team and -pipeline
+  reset     force the status to READY, requires -team, -pipeline, -reason
+            and admin actions
+  watch     show the status each time it changes
+
+flags:
+`
+
+type options struct {
+	source models.Source
+
+	sourceFile string
+	output     string
+
+	team     string
+	pipeline string
+	job      string
+	by       string
+
+	force    bool
+	reason   string
+	interval time.Duration
+}
+
+func main() {
+	opts, command, err := parseArgs(os.Args[1:], os.Stderr)
+	if err != nil {
+		log.Error("error parsing arguments", "error", err)
+		os.Exit(2)
+	}
+
+	// An invalid log_level is reported when the driver is constructed.
+	log, _ = logger.FromSource(opts.source)
+
+	d, err := driver.FromSource(opts.source)
+	if err == nil {
+		err = run(d, opts, command, os.Stdout, nil)
+	}
+	if err != nil {
+		log.Error("error running "+command, "error", err)
+		os.Exit(1)
+	}
+}
+
+func parseArgs(args []string, stderr io.Writer) (*options, string, error) {
+	opts := &options{}
+	flags := flag.NewFlagSet("pipeline-status", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	var source models.Source
+	flags.StringVar(&opts.sourceFile, "source", "", "file holding the resource's source configuration, as JSON or YAML")
+	flags.StringVar(&source.Bucket, "bucket", "", "bucket holding the status, overrides the source file")
+	flags.StringVar(&source.Key, "key", "", "key of the status, overrides the source file")
+	flags.StringVar(&source.KeyPrefix, "key-prefix", "", "prefix of the statuses to list, overrides the source file")
+	flags.StringVar(&source.RegionName, "region", "", "region of the bucket, overrides the source file")
+	flags.StringVar(&source.Endpoint, "endpoint", "", "custom endpoint of the bucket, overrides the source file")
+	flags.StringVar(&source.AccessKeyID, "access-key-id", "", "access key, overrides the source file")
+	flags.StringVar(&source.SecretAccessKey, "secret-access-key", "", "secret key, overrides the source file")
+	flags.StringVar((*string)(&source.CredentialProvider), "credential-provider", "", "where credentials are read from, such as env or default, overrides the source file")
+	flags.StringVar(&opts.output, "output", "table", "output format, table or json")
+	flags.StringVar(&opts.team, "team", "", "team to act as, required by start, finish, fail and reset")
+	flags.StringVar(&opts.pipeline, "pipeline", "", "pipeline to act as, required by start, finish, fail and reset")
+	flags.StringVar(&opts.job, "job", "pipeline-status", "job to act as")
+	flags.StringVar(&opts.by, "by", os.Getenv("USER"), "who is acting, recorded as the build of the job")
+	flags.BoolVar(&opts.force, "force", false, "let finish and fail end a run started by another build")
+	flags.StringVar(&opts.reason, "reason", "", "why the status is being reset")
+	flags.BoolVar(&source.AllowAdminActions, "allow-admin-actions", false, "let reset force the status READY when the source does not allow admin actions")
+	flags.DurationVar(&opts.interval, "interval", 10*time.Second, "how often watch polls the status")
+	showVersion := flags.Bool("version", false, "print the version and exit")
+
+	if err := flags.Parse(args); err != nil {
+		return nil, "", err
+	}
+
+	if *showVersion {
+		fmt.Fprintln(stderr, VERSION)
+		os.Exit(0)
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return nil, "", fmt.Errorf("expected exactly one command")
+	}
+
+	if opts.output != "table" && opts.output != "json" {
+		return nil, "", fmt.Errorf("unknown output %q, expected table or json", opts.output)
+	}
+
+	if opts.sourceFile != "" {
+		var err error
+		if opts.source, err = driver.ReadSource(opts.sourceFile); err != nil {
+			return nil, "", err
+		}
+	}
+	mergeSource(&opts.source, source)
+
+	return opts, flags.Arg(0), nil
+}
+
+// mergeSource overrides the source with the settings given as flags.
+func mergeSource(source *models.Source, flags models.Source) {
+	override := func(value *string, flag string) {
+		if flag != "" {
+			*value = flag
+		}
+	}
+
+	override(&source.Bucket, flags.Bucket)
+	override(&source.RegionName, flags.RegionName)
+	override(&source.Endpoint, flags.Endpoint)
+	override(&source.AccessKeyID, flags.AccessKeyID)
+	override(&source.SecretAccessKey, flags.SecretAccessKey)
+	override((*string)(&source.CredentialProvider), string(flags.CredentialProvider))
+
+	if flags.AllowAdminActions {
+		source.AllowAdminActions = true
+	}
+
+	if flags.Key != "" {
+		source.Key, source.Keys, source.KeyPrefix = flags.Key, nil, ""
+	}
+	if flags.KeyPrefix != "" {
+		source.Key, source.Keys, source.KeyPrefix = "", nil, flags.KeyPrefix
+	}
+}
+
+// run carries out the command with the driver, stopping watch when stop is
+// closed.
+func run(d driver.Driver, opts *options, command string, stdout io.Writer, stop <-chan struct{}) error {
+	out := &printer{w: stdout, json: opts.output == "json"}
+
+	switch command {
+	case "get":
+		status, err := load(d)
+		if err != nil {
+			return err
+		}
+		return out.status(status)
+
+	case "list":
+		summarizer, ok := d.(driver.Summarizer)
+		if !ok {
+			return fmt.Errorf("list needs keys or key_prefix in the source, or -key-prefix")
+		}
+
+		summary, err := summarizer.Summary()
+		if err != nil {
+			return err
+		}
+		return out.summary(summary)
+
+	case "history":
+		status, err := load(d)
+		if err != nil {
+			return err
+		}
+		return out.history(status.History)
+
+	case "start", "finish", "fail", "reset":
+		if err := actAs(d, command, opts); err != nil {
+			return err
+		}
+
+		var err error
+		switch command {
+		case "start":
+			_, err = d.Start()
+		case "finish":
+			_, err = d.Finish(opts.force)
+		case "fail":
+			_, err = d.Fail(opts.force)
+		case "reset":
+			_, err = d.ForceReady(opts.reason)
+		}
+		if err != nil {
+			return err
+		}
+
+		// Show the status as stored, along with the builds still queued.
+		status, err := load(d)
+		if err != nil {
+			return err
+		}
+		return out.status(status)
+
+	case "watch":
+		return watch(d, opts.interval, out, stop)
+
+	default:
+		return fmt.Errorf("unknown command, expected one of get, list, history, start, finish, fail, reset or watch")
+	}
+}
+
+// actAs gives the driver the build metadata it records for the actions it
+// takes, leaving the environment of the process alone. Changing a status
+// needs the team and pipeline to act as, so the ownership checks of finish
+// and fail apply to the tool as to any pipeline, and the operator given with
+// -by is recorded as the build.
+func actAs(d driver.Driver, command string, opts *options) error {
+	if opts.team == "" || opts.pipeline == "" {
+		return fmt.Errorf("%s needs -team and -pipeline", command)
+	}
+
+	setter, ok := d.(driver.EnvSetter)
+	if !ok {
+		return fmt.Errorf("%s is not supported by this driver", command)
+	}
+
+	env := venv.Mock()
+	env.Setenv("BUILD_TEAM_NAME", opts.team)
+	env.Setenv("BUILD_PIPELINE_NAME", opts.pipeline)
+	env.Setenv("BUILD_JOB_NAME", opts.job)
+	env.Setenv("BUILD_NAME", opts.by)
+	setter.SetEnv(env)
+
+	return nil
+}
+
+// load reads the status along with the builds queued to start it.
+func load(d driver.Driver) (*models.PipelineStatus, error) {
+	status := &models.PipelineStatus{}
+	if ok, err := d.Load(status); !ok || err != nil {
+		if err == nil {
+			err = fmt.Errorf("cannot load status")
+		}
+		return nil, err
+	}
+
+	if queuer, ok := d.(driver.Queuer); ok {
+		var err error
+		if status.Queue, err = queuer.Tickets(); err != nil {
+			return nil, err
+		}
+	}
+
+	return status, nil
+}
+
+// watch prints the status whenever its state, build or modification time
+// changes, until interrupted or stop is closed.
+func watch(d driver.Driver, interval time.Duration, out *printer, stop <-chan struct{}) error {
+	last := models.PipelineStatus{}
+	first := true
+
+	for {
+		status := &models.PipelineStatus{}
+		ok, err := d.Load(status)
+		if !ok {
+			return err
+		}
+
+		if first || status.State != last.State || status.BuildNumber != last.BuildNumber ||
+			status.LastModified != last.LastModified {
+			if err := out.change(status); err != nil {
+				return err
+			}
+			last = *status
+			first = false
+		}
+
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
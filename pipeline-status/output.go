@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/schema"
+	"github.com/pivotalservices/pipeline-status-resource/state"
+)
+
+// printer writes statuses either as tables for people or as JSON for
+// scripts. JSON uses the same field names as the stored status.
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+func (p *printer) status(status *models.PipelineStatus) error {
+	if p.json {
+		return p.writeJSON(schema.EncodeAs(status, schema.FormatJSON))
+	}
+
+	rows := [][]string{
+		{"pipeline", status.Pipeline},
+		{"team", status.Team},
+		{"build", status.BuildNumber},
+		{"state", string(status.State)},
+		{"last modified", status.LastModified},
+	}
+
+	if status.Holder != nil {
+		rows = append(rows, []string{"holder", state.DescribeBuild(*status.Holder)})
+	}
+	for _, holder := range status.Holders {
+		rows = append(rows, []string{"holder", state.DescribeBuild(holder)})
+	}
+	for _, ticket := range status.Queue {
+		rows = append(rows, []string{"queued", fmt.Sprintf("%s since %s", state.DescribeBuild(ticket.Build), ticket.Enqueued)})
+	}
+	if status.Failure != nil {
+		rows = append(rows, []string{"failure", describeFailure(status.Failure)})
+	}
+	if state.IsFrozen(status, time.Now()) {
+		rows = append(rows, []string{"freeze", state.DescribeFreeze(status.Freeze)})
+	}
+	if len(status.DependsOn) > 0 {
+		rows = append(rows, []string{"depends on", strings.Join(status.DependsOn, ", ")})
+	}
+
+	return p.table(nil, rows)
+}
+
+func (p *printer) summary(summary *models.StatusSummary) error {
+	if p.json {
+		return p.writeJSON(schema.ToJSON(summary))
+	}
+
+	rows := [][]string{}
+	for _, s := range summary.Pipelines {
+		rows = append(rows, []string{s.Key, s.Team, s.Pipeline, s.BuildNumber, string(s.State), describeFailure(s.Failure)})
+	}
+	rows = append(rows, []string{"", "", "", summary.BuildNumber, string(summary.State), ""})
+
+	return p.table([]string{"KEY", "TEAM", "PIPELINE", "BUILD", "STATE", "FAILURE"}, rows)
+}
+
+func (p *printer) history(events []models.StatusEvent) error {
+	if p.json {
+		return p.writeJSON(schema.ToJSON(struct {
+			History []models.StatusEvent `yaml:"history"`
+		}{events}))
+	}
+
+	rows := [][]string{}
+	for _, e := range events {
+		rows = append(rows, []string{e.Time, string(e.Action), state.DescribeBuild(e.By),
+			string(e.From), string(e.To), e.Reason})
+	}
+
+	return p.table([]string{"TIME", "ACTION", "BY", "FROM", "TO", "REASON"}, rows)
+}
+
+// change reports a status seen by watch on a single line.
+func (p *printer) change(status *models.PipelineStatus) error {
+	if p.json {
+		data, err := schema.EncodeAs(status, schema.FormatJSON)
+		if err != nil {
+			return err
+		}
+
+		line := &bytes.Buffer{}
+		if err = json.Compact(line, data); err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(p.w, line.String())
+		return err
+	}
+
+	line := fmt.Sprintf("%s  build %s  %s", status.LastModified, status.BuildNumber, status.State)
+	if status.Failure != nil {
+		line += "  failed " + describeFailure(status.Failure)
+	}
+
+	_, err := fmt.Fprintln(p.w, line)
+	return err
+}
+
+func (p *printer) table(header []string, rows [][]string) error {
+	w := tabwriter.NewWriter(p.w, 0, 8, 2, ' ', 0)
+
+	if header != nil {
+		fmt.Fprintln(w, strings.Join(header, "\t"))
+	}
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+
+	return w.Flush()
+}
+
+func (p *printer) writeJSON(data []byte, err error) error {
+	if err != nil {
+		return err
+	}
+
+	_, err = p.w.Write(data)
+	return err
+}
+
+func describeFailure(failure *models.BuildFailure) string {
+	if failure == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%s #%s %s", failure.JobName, failure.BuildName, failure.DetailsURL)
+}
@@ -0,0 +1,27 @@
+package main_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+var cliPath string
+
+var _ = BeforeSuite(func() {
+	var err error
+
+	cliPath, err = gexec.Build("github.com/pivotalservices/pipeline-status-resource/pipeline-status")
+	Expect(err).NotTo(HaveOccurred())
+})
+
+var _ = AfterSuite(func() {
+	gexec.CleanupBuildArtifacts()
+})
+
+func TestPipelineStatus(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Pipeline Status Suite")
+}
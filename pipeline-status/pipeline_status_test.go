@@ -0,0 +1,74 @@
+package main_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("pipeline-status", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "pipeline-status")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	run := func(args ...string) *gexec.Session {
+		session, err := gexec.Start(exec.Command(cliPath, args...), GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(session).Should(gexec.Exit())
+		return session
+	}
+
+	writeSource := func(content string) string {
+		file := filepath.Join(dir, "source.yml")
+		Expect(ioutil.WriteFile(file, []byte(content), 0644)).To(Succeed())
+		return file
+	}
+
+	It("prints usage without a command", func() {
+		session := run()
+		Expect(session.ExitCode()).To(Equal(2))
+		Expect(session.Err).To(gbytes.Say("usage: pipeline-status"))
+	})
+
+	It("rejects unknown output formats", func() {
+		session := run("-output", "xml", "get")
+		Expect(session.ExitCode()).To(Equal(2))
+		Expect(session.Err).To(gbytes.Say(`level=error msg="error parsing arguments" error="unknown output \\"xml\\", expected table or json"`))
+	})
+
+	It("rejects unknown commands", func() {
+		session := run("-bucket", "b", "-key", "status.yml", "remove")
+		Expect(session.ExitCode()).To(Equal(1))
+		Expect(session.Err).To(gbytes.Say(`level=error msg="error running remove" error="unknown command`))
+	})
+
+	It("reads the source from a YAML file", func() {
+		source := writeSource("bucket: b\nkey: status.yml\nformat: toml\n")
+
+		session := run("-source", source, "get")
+		Expect(session.ExitCode()).To(Equal(1))
+		Expect(session.Err).To(gbytes.Say(`level=error msg="error running get" error="unknown format \\"toml\\"`))
+	})
+
+	It("lets flags override the source file", func() {
+		source := writeSource(`{"bucket": "b", "keys": ["a.yml", "b.yml"]}`)
+
+		session := run("-source", source, "-key", "status.yml", "list")
+		Expect(session.ExitCode()).To(Equal(1))
+		Expect(session.Err).To(gbytes.Say(`level=error msg="error running list" error="list needs keys or key_prefix`))
+	})
+})
@@ -0,0 +1,140 @@
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+
+	"github.com/pivotalservices/pipeline-status-resource/models"
+)
+
+// Placeholder replaces the value of a secret.
+const Placeholder = "[REDACTED]"
+
+// Source returns a copy of the source with every secret replaced by the
+// placeholder, safe to log or dump while debugging.
+func Source(source models.Source) models.Source {
+	for _, field := range secretFields(&source) {
+		if *field != "" {
+			*field = Placeholder
+		}
+	}
+
+	notifications := make([]models.Notification, len(source.Notifications))
+	for i, n := range source.Notifications {
+		n.URL = redactURL(n.URL)
+		if n.Secret != "" {
+			n.Secret = Placeholder
+		}
+
+		if n.Headers != nil {
+			headers := map[string]string{}
+			for name := range n.Headers {
+				headers[name] = Placeholder
+			}
+			n.Headers = headers
+		}
+
+		notifications[i] = n
+	}
+	if source.Notifications != nil {
+		source.Notifications = notifications
+	}
+
+	return source
+}
+
+// Request renders a check, in or out request as JSON for the debug log, with
+// the secrets of its source replaced by the placeholder.
+func Request(request interface{}) string {
+	switch r := request.(type) {
+	case models.CheckRequest:
+		r.Source = Source(r.Source)
+		request = r
+	case models.InRequest:
+		r.Source = Source(r.Source)
+		request = r
+	case models.OutRequest:
+		r.Source = Source(r.Source)
+		request = r
+	default:
+		return fmt.Sprintf("%T cannot be redacted", request)
+	}
+
+	data, err := json.Marshal(request)
+	if err != nil {
+		return err.Error()
+	}
+
+	return string(data)
+}
+
+// Secrets returns the values of the source's secrets that are set, so they
+// can be masked wherever they turn up.
+func Secrets(source models.Source) []string {
+	secrets := []string{}
+	for _, field := range secretFields(&source) {
+		if *field != "" {
+			secrets = append(secrets, *field)
+		}
+	}
+
+	for _, n := range source.Notifications {
+		if redactURL(n.URL) != n.URL {
+			secrets = append(secrets, n.URL)
+		}
+		if n.Secret != "" {
+			secrets = append(secrets, n.Secret)
+		}
+		for _, value := range n.Headers {
+			if value != "" {
+				secrets = append(secrets, value)
+			}
+		}
+	}
+
+	return secrets
+}
+
+// secretHeaders matches the lines of HTTP dumps and signing strings carrying
+// credentials: request signatures, temporary session tokens and customer
+// encryption keys.
+var secretHeaders = regexp.MustCompile(`(?im)^(\s*(?:authorization|x-amz-security-token|x-amz-server-side-encryption-customer-key[\w-]*)\s*:).*$`)
+
+// Headers replaces the values of credential headers in a dump of HTTP
+// requests, such as the SDK's debug log, with the placeholder.
+func Headers(dump string) string {
+	return secretHeaders.ReplaceAllString(dump, "${1} "+Placeholder)
+}
+
+// secretFields points at the source's secret fields, including the
+// OpenStack credentials.
+func secretFields(source *models.Source) []*string {
+	return []*string{
+		&source.SecretAccessKey,
+		&source.SessionToken,
+		&source.SSECustomerKey,
+		&source.PrivateKey,
+		&source.Password,
+		&source.JSONKey,
+		&source.OpenStack.Password,
+		&source.OpenStack.APIKey,
+		&source.OpenStack.TokenID,
+	}
+}
+
+// redactURL keeps only the scheme and host of a URL with a path or query,
+// where chat services such as Slack and Teams put the webhook's token.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Placeholder
+	}
+
+	if (u.Path == "" || u.Path == "/") && u.RawQuery == "" && u.User == nil {
+		return raw
+	}
+
+	return u.Scheme + "://" + u.Host + "/" + Placeholder
+}
@@ -0,0 +1,132 @@
+package redact_test
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/redact"
+)
+
+var secrets = []string{
+	"aws-secret-value",
+	"ssh-private-key-value",
+	"git-password-value",
+	"gcs-json-key-value",
+	"openstack-password-value",
+	"openstack-api-key-value",
+	"openstack-token-value",
+	"webhook-secret-value",
+	"Bearer webhook-token-value",
+}
+
+func sourceWithSecrets() models.Source {
+	return models.Source{
+		Bucket:          "statuses",
+		Key:             "status/deploy.yml",
+		AccessKeyID:     "AKIAEXAMPLE",
+		SecretAccessKey: "aws-secret-value",
+		PrivateKey:      "ssh-private-key-value",
+		Username:        "git",
+		Password:        "git-password-value",
+		JSONKey:         "gcs-json-key-value",
+		OpenStack: models.OpenStackOptions{
+			Username: "swift",
+			Password: "openstack-password-value",
+			APIKey:   "openstack-api-key-value",
+			TokenID:  "openstack-token-value",
+		},
+		Notifications: []models.Notification{{
+			URL:     "https://hooks.example.com",
+			Secret:  "webhook-secret-value",
+			Headers: map[string]string{"Authorization": "Bearer webhook-token-value"},
+		}},
+	}
+}
+
+var _ = Describe("Redact", func() {
+	It("replaces every secret in the source", func() {
+		data, err := json.Marshal(redact.Source(sourceWithSecrets()))
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, secret := range secrets {
+			Expect(string(data)).NotTo(ContainSubstring(secret))
+		}
+		Expect(string(data)).To(ContainSubstring(`"secret_access_key":"[REDACTED]"`))
+		Expect(string(data)).To(ContainSubstring(`"Authorization":"[REDACTED]"`))
+	})
+
+	It("renders requests with their source redacted", func() {
+		for _, request := range []interface{}{
+			models.CheckRequest{Source: sourceWithSecrets()},
+			models.InRequest{Source: sourceWithSecrets()},
+			models.OutRequest{Source: sourceWithSecrets(), Params: models.OutParams{Action: models.Start}},
+		} {
+			dump := redact.Request(request)
+			for _, secret := range secrets {
+				Expect(dump).NotTo(ContainSubstring(secret))
+			}
+			Expect(dump).To(ContainSubstring(`"bucket":"statuses"`))
+		}
+
+		Expect(redact.Request(sourceWithSecrets())).To(Equal("models.Source cannot be redacted"))
+	})
+
+	It("keeps only the host of a webhook url with a token", func() {
+		source := sourceWithSecrets()
+		source.Notifications = append(source.Notifications, models.Notification{
+			URL: "https://hooks.slack.com/services/T0000/B0000/XXXXXXXXXXXXXXXX",
+		})
+
+		data, err := json.Marshal(redact.Source(source))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).NotTo(ContainSubstring("/services/"))
+		Expect(string(data)).To(ContainSubstring(`"url":"https://hooks.slack.com/[REDACTED]"`))
+
+		Expect(redact.Secrets(source)).To(ContainElement("https://hooks.slack.com/services/T0000/B0000/XXXXXXXXXXXXXXXX"))
+	})
+
+	It("keeps everything else", func() {
+		redacted := redact.Source(sourceWithSecrets())
+
+		Expect(redacted.Bucket).To(Equal("statuses"))
+		Expect(redacted.AccessKeyID).To(Equal("AKIAEXAMPLE"))
+		Expect(redacted.OpenStack.Username).To(Equal("swift"))
+		Expect(redacted.Notifications[0].URL).To(Equal("https://hooks.example.com"))
+		Expect(redact.Source(models.Source{}).SecretAccessKey).To(BeEmpty())
+	})
+
+	It("leaves the original source alone", func() {
+		source := sourceWithSecrets()
+		redact.Source(source)
+
+		Expect(source.SecretAccessKey).To(Equal("aws-secret-value"))
+		Expect(source.Notifications[0].Secret).To(Equal("webhook-secret-value"))
+		Expect(source.Notifications[0].Headers["Authorization"]).To(Equal("Bearer webhook-token-value"))
+	})
+
+	It("lists the secrets that are set", func() {
+		Expect(redact.Secrets(sourceWithSecrets())).To(ConsistOf(secrets))
+		Expect(redact.Secrets(models.Source{})).To(BeEmpty())
+	})
+
+	It("hides credential headers in request dumps", func() {
+		dump := "PUT /statuses/status.yml HTTP/1.1\r\n" +
+			"Host: s3.amazonaws.com\r\n" +
+			"Authorization: AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20170918/us-east-1/s3/aws4_request, Signature=abc123\r\n" +
+			"X-Amz-Security-Token: session-token-value\r\n" +
+			"X-Amz-Server-Side-Encryption-Customer-Key: customer-key-value\r\n" +
+			"X-Amz-Server-Side-Encryption-Customer-Key-Md5: customer-key-md5\r\n" +
+			"x-amz-security-token:session-token-value\n" +
+			"Content-Type: application/x-yaml\r\n"
+
+		redacted := redact.Headers(dump)
+		Expect(redacted).NotTo(ContainSubstring("Signature=abc123"))
+		Expect(redacted).NotTo(ContainSubstring("session-token-value"))
+		Expect(redacted).NotTo(ContainSubstring("customer-key"))
+		Expect(redacted).To(ContainSubstring("X-Amz-Security-Token: [REDACTED]"))
+		Expect(redacted).To(ContainSubstring("Host: s3.amazonaws.com"))
+		Expect(redacted).To(ContainSubstring("Content-Type: application/x-yaml"))
+	})
+})
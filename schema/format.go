@@ -0,0 +1,135 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/pivotalservices/pipeline-status-resource/models"
+)
+
+// Format is the encoding a status is stored in.
+type Format string
+
+const (
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+)
+
+// ParseFormat validates a configured format, defaulting to YAML.
+func ParseFormat(value string) (Format, error) {
+	switch Format(value) {
+	case "", FormatYAML:
+		return FormatYAML, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	default:
+		return "", fmt.Errorf("unknown format %q, expected yaml or json", value)
+	}
+}
+
+// Detect reports which format a stored document is in. JSON documents are
+// always objects, so anything else is taken to be YAML.
+func Detect(data []byte) Format {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return FormatJSON
+	}
+
+	return FormatYAML
+}
+
+// ContentType returns the content type a status in the format is stored
+// with.
+func ContentType(format Format) string {
+	if format == FormatJSON {
+		return "application/json"
+	}
+
+	return "text/plain"
+}
+
+// EncodeAs writes a status in the given format, stamped like Encode. JSON
+// documents use the same field names and order as YAML ones.
+func EncodeAs(status *models.PipelineStatus, format Format) ([]byte, error) {
+	encoded, err := Encode(status)
+	if err != nil || format != FormatJSON {
+		return encoded, err
+	}
+
+	return YAMLToJSON(encoded)
+}
+
+// ToJSON writes a value as indented JSON using the field names of its YAML
+// tags, so models only need to declare YAML tags.
+func ToJSON(value interface{}) ([]byte, error) {
+	encoded, err := yaml.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return YAMLToJSON(encoded)
+}
+
+// YAMLToJSON converts a YAML mapping to an indented JSON object, keeping the
+// order of its keys.
+func YAMLToJSON(data []byte) ([]byte, error) {
+	doc := yaml.MapSlice{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	out, err := json.MarshalIndent(jsonValue(doc), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(out, '\n'), nil
+}
+
+// orderedObject marshals a YAML mapping as a JSON object without losing the
+// order of its keys.
+type orderedObject yaml.MapSlice
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+
+	for i, item := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		key, err := json.Marshal(fmt.Sprint(item.Key))
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(jsonValue(item.Value))
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		return orderedObject(v)
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, item := range v {
+			values[i] = jsonValue(item)
+		}
+		return values
+	default:
+		return v
+	}
+}
@@ -0,0 +1,75 @@
+package schema_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/schema"
+)
+
+var _ = Describe("Formats", func() {
+	read := func(file string) []byte {
+		data, err := ioutil.ReadFile(filepath.Join("fixtures", file))
+		Expect(err).NotTo(HaveOccurred())
+		return data
+	}
+
+	decode := func(data []byte) *models.PipelineStatus {
+		status := &models.PipelineStatus{}
+		Expect(schema.Decode(data, status)).To(Succeed())
+		return status
+	}
+
+	DescribeTable("round trips through both formats",
+		func(name string) {
+			fromYAML := decode(read(name + ".yml"))
+
+			asJSON, err := schema.EncodeAs(fromYAML, schema.FormatJSON)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(schema.Detect(asJSON)).To(Equal(schema.FormatJSON))
+
+			fromJSON := decode(asJSON)
+			Expect(fromJSON).To(Equal(fromYAML))
+
+			asYAML, err := schema.EncodeAs(fromJSON, schema.FormatYAML)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(schema.Detect(asYAML)).To(Equal(schema.FormatYAML))
+			Expect(string(asYAML)).To(Equal(string(read(name + ".golden.yml"))))
+		},
+		Entry("original format", "v0-original"),
+		Entry("hand written original format", "v0-hand-written"),
+		Entry("current format", "v1-current"),
+		Entry("newer format", "v2-future"),
+	)
+
+	It("writes JSON with the same field names and order as YAML", func() {
+		asJSON, err := schema.EncodeAs(decode(read("v0-original.yml")), schema.FormatJSON)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(asJSON)).To(Equal(string(read("v0-original.golden.json"))))
+	})
+
+	It("reads JSON written by other tools", func() {
+		status := decode([]byte(`{"pipeline": "deploy", "team": "main", "build": 4, "state": "ready"}`))
+		Expect(status.SchemaVersion).To(Equal(schema.CurrentVersion))
+		Expect(status.BuildNumber).To(Equal("4"))
+		Expect(status.State).To(Equal(models.StateReady))
+	})
+
+	It("validates the configured format", func() {
+		format, err := schema.ParseFormat("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(format).To(Equal(schema.FormatYAML))
+		Expect(schema.ContentType(format)).To(Equal("text/plain"))
+
+		format, err = schema.ParseFormat("json")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(schema.ContentType(format)).To(Equal("application/json"))
+
+		_, err = schema.ParseFormat("toml")
+		Expect(err).To(MatchError(`unknown format "toml", expected yaml or json`))
+	})
+})
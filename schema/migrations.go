@@ -0,0 +1,34 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pivotalservices/pipeline-status-resource/models"
+)
+
+// legacyDateFormat is the timestamp format some early and hand written
+// statuses used, without a UTC offset.
+const legacyDateFormat = "2006-01-02T15:04:05"
+
+// migrateV0 upgrades the original, unversioned format. Build numbers are
+// stored as strings, states are upper cased and timestamps without an
+// offset are taken to be UTC.
+func migrateV0(doc map[string]interface{}) error {
+	if build, ok := doc["build"]; ok && build != nil {
+		doc["build"] = fmt.Sprint(build)
+	}
+
+	if state, ok := doc["state"].(string); ok {
+		doc["state"] = strings.ToUpper(state)
+	}
+
+	if lastModified, ok := doc["last_modified"].(string); ok {
+		if t, err := time.Parse(legacyDateFormat, lastModified); err == nil {
+			doc["last_modified"] = t.Format(models.ISO8601DateFormat)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/pivotalservices/pipeline-status-resource/models"
+)
+
+// CurrentVersion is the schema version written by this code. Bump it and add
+// a migration whenever the stored document changes in a way older documents
+// need upgrading for.
+const CurrentVersion = 1
+
+// migration upgrades a raw document from one schema version to the next.
+type migration func(doc map[string]interface{}) error
+
+// migrations[v] upgrades a document from version v to v+1.
+var migrations = []migration{
+	migrateV0,
+}
+
+// Decode reads a stored status in either format, upgrading documents written
+// with an older schema version. Documents written by a newer version are read
+// as they are, with unknown fields kept in the status' Extra fields.
+func Decode(data []byte, status *models.PipelineStatus) error {
+	doc := map[string]interface{}{}
+
+	var err error
+	if Detect(data) == FormatJSON {
+		err = json.Unmarshal(data, &doc)
+	} else {
+		err = yaml.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(doc) == 0 {
+		return nil
+	}
+
+	version, err := versionOf(doc)
+	if err != nil {
+		return err
+	}
+
+	for v := version; v < CurrentVersion; v++ {
+		if err := migrations[v](doc); err != nil {
+			return fmt.Errorf("migrating status from schema version %d: %s", v, err)
+		}
+		doc["schema_version"] = v + 1
+	}
+
+	migrated, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	return yaml.Unmarshal(migrated, status)
+}
+
+// Encode writes a status, stamping it with the current schema version unless
+// it was read from a newer one.
+func Encode(status *models.PipelineStatus) ([]byte, error) {
+	stamped := *status
+	if stamped.SchemaVersion < CurrentVersion {
+		stamped.SchemaVersion = CurrentVersion
+	}
+
+	return yaml.Marshal(&stamped)
+}
+
+func versionOf(doc map[string]interface{}) (int, error) {
+	raw, ok := doc["schema_version"]
+	if !ok || raw == nil {
+		return 0, nil
+	}
+
+	var version int
+	switch v := raw.(type) {
+	case int:
+		version = v
+	case float64:
+		version = int(v)
+	case string:
+		var err error
+		if version, err = strconv.Atoi(v); err != nil {
+			return 0, fmt.Errorf("invalid schema_version %q", v)
+		}
+	default:
+		return 0, fmt.Errorf("invalid schema_version %v", raw)
+	}
+
+	if version < 0 {
+		return 0, fmt.Errorf("invalid schema_version %d", version)
+	}
+
+	return version, nil
+}
@@ -0,0 +1,92 @@
+package schema_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/schema"
+)
+
+// Set UPDATE_GOLDEN=true to rewrite the golden files after an intended
+// change to the stored format.
+var updateGolden = os.Getenv("UPDATE_GOLDEN") == "true"
+
+var _ = Describe("Schema", func() {
+	load := func(name string) *models.PipelineStatus {
+		data, err := ioutil.ReadFile(filepath.Join("fixtures", name+".yml"))
+		Expect(err).NotTo(HaveOccurred())
+
+		status := &models.PipelineStatus{}
+		Expect(schema.Decode(data, status)).To(Succeed())
+		return status
+	}
+
+	DescribeTable("upgrades each historical format to match its golden file",
+		func(name string) {
+			encoded, err := schema.Encode(load(name))
+			Expect(err).NotTo(HaveOccurred())
+
+			golden := filepath.Join("fixtures", name+".golden.yml")
+			if updateGolden {
+				Expect(ioutil.WriteFile(golden, encoded, 0644)).To(Succeed())
+			}
+
+			expected, err := ioutil.ReadFile(golden)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(encoded)).To(Equal(string(expected)))
+		},
+		Entry("original format", "v0-original"),
+		Entry("hand written original format", "v0-hand-written"),
+		Entry("current format", "v1-current"),
+		Entry("newer format", "v2-future"),
+	)
+
+	It("reads the original format", func() {
+		status := load("v0-original")
+		Expect(status.SchemaVersion).To(Equal(schema.CurrentVersion))
+		Expect(status.BuildNumber).To(Equal("12"))
+		Expect(status.State).To(Equal(models.StateReady))
+		Expect(status.Failure.DetailsURL).To(HaveSuffix("/builds/11"))
+	})
+
+	It("normalises hand written statuses", func() {
+		status := load("v0-hand-written")
+		Expect(status.BuildNumber).To(Equal("3"))
+		Expect(status.State).To(Equal(models.StateRunning))
+		Expect(status.LastModified).To(Equal("2017-03-14T23:33:45+0000"))
+	})
+
+	It("keeps fields from newer versions", func() {
+		status := load("v2-future")
+		Expect(status.SchemaVersion).To(Equal(2))
+		Expect(status.Extra).To(HaveKey("approvals"))
+	})
+
+	It("stamps new statuses with the current version", func() {
+		encoded, err := schema.Encode(&models.PipelineStatus{State: models.StateReady})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(encoded)).To(HavePrefix("schema_version: 1\n"))
+	})
+
+	It("reads empty documents as an empty status", func() {
+		status := &models.PipelineStatus{}
+		Expect(schema.Decode([]byte(""), status)).To(Succeed())
+		Expect(*status).To(Equal(models.PipelineStatus{}))
+	})
+
+	It("rejects invalid schema versions", func() {
+		status := &models.PipelineStatus{}
+		Expect(schema.Decode([]byte("schema_version: later\n"), status)).To(MatchError(`invalid schema_version "later"`))
+	})
+
+	It("rejects negative schema versions", func() {
+		status := &models.PipelineStatus{}
+		Expect(schema.Decode([]byte("schema_version: -1\n"), status)).To(MatchError("invalid schema_version -1"))
+		Expect(schema.Decode([]byte(`{"schema_version": -2}`), status)).To(MatchError("invalid schema_version -2"))
+	})
+})
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pivotalservices/pipeline-status-resource/badge"
+	"github.com/pivotalservices/pipeline-status-resource/clock"
+	"github.com/pivotalservices/pipeline-status-resource/driver"
+	"github.com/pivotalservices/pipeline-status-resource/logger"
+	"github.com/pivotalservices/pipeline-status-resource/metrics"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/schema"
+	"github.com/pivotalservices/pipeline-status-resource/state"
+)
+
+// Server serves the statuses tracked by a driver as a JSON API under
+// /api/statuses, as Prometheus metrics under /metrics, as an HTML board
+// under /, and as badges under /badge.svg for the overall state and
+// /badges/<key> for each status. Drivers tracking several keys report each
+// of them; other drivers report their single status.
+//
+// Statuses are read at most once per CacheTTL, however many requests are
+// served.
+type Server struct {
+	Driver   driver.Driver
+	Clock    clock.Clock
+	CacheTTL time.Duration
+	Log      *logger.Logger
+
+	mutex    sync.Mutex
+	cached   *models.StatusSummary
+	cachedAt time.Time
+}
+
+// DefaultCacheTTL is how long New's servers reuse the statuses they read.
+const DefaultCacheTTL = 5 * time.Second
+
+// New returns a server reporting the statuses tracked by the driver.
+func New(d driver.Driver) *Server {
+	return &Server{Driver: d, Clock: clock.System(), CacheTTL: DefaultCacheTTL}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/badge.svg":
+		s.serve(w, r, badge.ContentType, func(summary *models.StatusSummary) ([]byte, error) {
+			return badge.ForSummary(summary, "pipelines").SVG(), nil
+		})
+	case strings.HasPrefix(r.URL.Path, "/badges/"):
+		key := strings.TrimPrefix(r.URL.Path, "/badges/")
+		s.serve(w, r, badge.ContentType, func(summary *models.StatusSummary) ([]byte, error) {
+			for _, p := range summary.Pipelines {
+				if p.Key == key || driver.BadgeKey(p.Key) == key {
+					return badge.ForPipeline(p).SVG(), nil
+				}
+			}
+			return nil, errNotFound
+		})
+	case r.URL.Path == "/metrics":
+		s.serve(w, r, metrics.ContentType, func(summary *models.StatusSummary) ([]byte, error) {
+			buf := &bytes.Buffer{}
+			err := metrics.Write(buf, summary, s.now())
+			return buf.Bytes(), err
+		})
+	case r.URL.Path == "/api/statuses":
+		s.serve(w, r, "application/json", func(summary *models.StatusSummary) ([]byte, error) {
+			return schema.ToJSON(summary)
+		})
+	case r.URL.Path == "/":
+		s.serve(w, r, "text/html; charset=utf-8", func(summary *models.StatusSummary) ([]byte, error) {
+			buf := &bytes.Buffer{}
+			err := board.Execute(buf, summary)
+			return buf.Bytes(), err
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serve renders the current summary, answering with 304 Not Modified when
+// the client already holds the same rendering.
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, contentType string,
+	render func(*models.StatusSummary) ([]byte, error)) {
+
+	summary, err := s.cachedSummary()
+	if err != nil {
+		// Storage errors can name buckets and keys, so they are only logged.
+		s.Log.Error("Cannot load statuses", "path", r.URL.Path, "error", err)
+		http.Error(w, "cannot load statuses", http.StatusBadGateway)
+		return
+	}
+
+	body, err := render(summary)
+	if err == errNotFound {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	etag := fmt.Sprintf("\"%x\"", sha1.Sum(body))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if matchesETag(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
+
+// Summary loads every status the server reports.
+func (s *Server) Summary() (*models.StatusSummary, error) {
+	if summarizer, ok := s.Driver.(driver.Summarizer); ok {
+		return summarizer.Summary()
+	}
+
+	status := &models.PipelineStatus{}
+	if ok, err := s.Driver.Load(status); !ok {
+		return nil, err
+	}
+
+	key := ""
+	if s3Driver, ok := s.Driver.(*driver.S3Driver); ok {
+		key = s3Driver.Key
+	}
+
+	return state.Summarize([]string{key}, []*models.PipelineStatus{status}, s.now()), nil
+}
+
+// cachedSummary returns the summary read within the cache TTL, or reads it
+// again. Failed reads are not cached.
+func (s *Server) cachedSummary() (*models.StatusSummary, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	if s.cached != nil && now.Sub(s.cachedAt) < s.CacheTTL {
+		return s.cached, nil
+	}
+
+	summary, err := s.Summary()
+	if err != nil {
+		return nil, err
+	}
+
+	s.cached, s.cachedAt = summary, now
+	return summary, nil
+}
+
+func (s *Server) now() time.Time {
+	if s.Clock == nil {
+		return time.Now()
+	}
+
+	return s.Clock.Now()
+}
+
+var errNotFound = errors.New("not found")
+
+func matchesETag(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+var board = template.Must(template.New("board").Funcs(template.FuncMap{
+	"describe": state.DescribeBuild,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="30">
+<title>Pipeline status: {{.State}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { padding: 0.4em 1em; text-align: left; border-bottom: 1px solid #ddd; }
+.READY { color: #2a7d2a; }
+.RUNNING { color: #b07d00; }
+.FAILED, .failed { color: #b00020; }
+</style>
+</head>
+<body>
+<h1>Pipelines are <span class="{{.State}}">{{.State}}</span></h1>
+<table>
+<tr><th>Pipeline</th><th>Team</th><th>State</th><th>Build</th><th>Last modified</th><th>Holder</th><th>Failure</th></tr>
+{{- range .Pipelines}}
+<tr>
+<td title="{{.Key}}">{{if .Pipeline}}{{.Pipeline}}{{else}}{{.Key}}{{end}}</td>
+<td>{{.Team}}</td>
+<td class="{{.State}}">{{.State}}{{if .Frozen}} (frozen){{end}}</td>
+<td>{{.BuildNumber}}</td>
+<td>{{.LastModified}}</td>
+<td>{{range $i, $h := .Holders}}{{if $i}}, {{end}}{{describe $h}}{{end}}</td>
+<td class="failed">{{with .Failure}}<a href="{{.DetailsURL}}">{{.JobName}} #{{.BuildName}}</a>{{end}}</td>
+</tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
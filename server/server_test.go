@@ -0,0 +1,183 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/adammck/venv"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotalservices/pipeline-status-resource/clock"
+	"github.com/pivotalservices/pipeline-status-resource/driver"
+	"github.com/pivotalservices/pipeline-status-resource/logger"
+	"github.com/pivotalservices/pipeline-status-resource/server"
+)
+
+var _ = Describe("Server", func() {
+	var (
+		svc *driver.MemoryServicer
+		s   *server.Server
+	)
+
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	BeforeEach(func() {
+		svc = driver.NewMemoryServicer(map[string]string{
+			"status/deploy.yml": "team: main\npipeline: deploy\nbuild: \"4\"\nstate: RUNNING\n" +
+				"last_modified: 2017-09-18T10:00:00+0000\n" +
+				"holder: {team: main, pipeline: deploy, job: ship, build: \"12\"}\n",
+			"status/test.yml": "team: main\npipeline: test\nbuild: \"9\"\nstate: READY\n" +
+				"last_modified: 2017-09-18T09:00:00+0000\n" +
+				"failure: {job: unit, build: \"9\", details: \"https://ci/builds/9\"}\n",
+		})
+
+		s = server.New(&driver.AggregateDriver{
+			Base:   driver.S3Driver{Svc: svc, Env: venv.Mock()},
+			Prefix: "status/",
+		})
+		s.Clock = clock.Fixed(time.Date(2017, 9, 18, 11, 0, 0, 0, time.UTC))
+	})
+
+	It("serves every status as JSON", func() {
+		rec := get("/api/statuses", nil)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Content-Type")).To(Equal("application/json"))
+
+		var body struct {
+			State     string `json:"state"`
+			Pipelines []struct {
+				Key          string `json:"key"`
+				Pipeline     string `json:"pipeline"`
+				State        string `json:"state"`
+				BuildNumber  string `json:"build"`
+				LastModified string `json:"last_modified"`
+				Holders      []struct {
+					Job string `json:"job"`
+				} `json:"holders"`
+				Failure *struct {
+					DetailsURL string `json:"details"`
+				} `json:"failure"`
+			} `json:"pipelines"`
+		}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &body)).To(Succeed())
+
+		Expect(body.State).To(Equal("FAILED"))
+		Expect(body.Pipelines).To(HaveLen(2))
+		Expect(body.Pipelines[0].Key).To(Equal("status/deploy.yml"))
+		Expect(body.Pipelines[0].State).To(Equal("RUNNING"))
+		Expect(body.Pipelines[0].LastModified).To(Equal("2017-09-18T10:00:00+0000"))
+		Expect(body.Pipelines[0].Holders[0].Job).To(Equal("ship"))
+		Expect(body.Pipelines[1].BuildNumber).To(Equal("9"))
+		Expect(body.Pipelines[1].Failure.DetailsURL).To(Equal("https://ci/builds/9"))
+	})
+
+	It("serves an HTML board", func() {
+		rec := get("/", nil)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Content-Type")).To(HavePrefix("text/html"))
+		Expect(rec.Body.String()).To(ContainSubstring("main/deploy/ship #12"))
+		Expect(rec.Body.String()).To(ContainSubstring(`<a href="https://ci/builds/9">unit #9</a>`))
+	})
+
+	It("answers unchanged statuses with Not Modified", func() {
+		first := get("/api/statuses", nil)
+		etag := first.Header().Get("ETag")
+		Expect(etag).NotTo(BeEmpty())
+
+		rec := get("/api/statuses", http.Header{"If-None-Match": {etag}})
+		Expect(rec.Code).To(Equal(http.StatusNotModified))
+		Expect(rec.Body.Len()).To(BeZero())
+
+		_, err := (&driver.S3Driver{Svc: svc, Env: venv.Mock(), Key: "status/deploy.yml", SharedLock: true}).Finish(true)
+		Expect(err).NotTo(HaveOccurred())
+		s.Clock = clock.Fixed(time.Date(2017, 9, 18, 11, 1, 0, 0, time.UTC))
+
+		rec = get("/api/statuses", http.Header{"If-None-Match": {etag}})
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("ETag")).NotTo(Equal(etag))
+	})
+
+	It("reads the statuses again once the cache expires", func() {
+		Expect(get("/api/statuses", nil).Body.String()).To(ContainSubstring(`"state": "RUNNING"`))
+
+		_, err := (&driver.S3Driver{Svc: svc, Env: venv.Mock(), Key: "status/deploy.yml", SharedLock: true}).Finish(true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(get("/api/statuses", nil).Body.String()).To(ContainSubstring(`"state": "RUNNING"`))
+
+		s.Clock = clock.Fixed(time.Date(2017, 9, 18, 11, 0, 5, 0, time.UTC))
+		Expect(get("/api/statuses", nil).Body.String()).NotTo(ContainSubstring(`"state": "RUNNING"`))
+	})
+
+	It("keeps storage errors out of responses", func() {
+		out := &bytes.Buffer{}
+		s.Log = logger.New(out, logger.Info)
+		s.Driver = &driver.AggregateDriver{
+			Base:   driver.S3Driver{Svc: failingService{svc}, Env: venv.Mock(), BucketName: "secret-bucket"},
+			Prefix: "status/",
+		}
+
+		rec := get("/api/statuses", nil)
+		Expect(rec.Code).To(Equal(http.StatusBadGateway))
+		Expect(rec.Body.String()).To(Equal("cannot load statuses\n"))
+		Expect(out.String()).To(ContainSubstring(`msg="Cannot load statuses" path=/api/statuses error="AccessDenied: secret-bucket"`))
+	})
+
+	It("serves a single status", func() {
+		s.Driver = &driver.S3Driver{Svc: svc, Env: venv.Mock(), Key: "status/test.yml"}
+
+		rec := get("/api/statuses", nil)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(ContainSubstring(`"key": "status/test.yml"`))
+	})
+
+	It("serves badges", func() {
+		rec := get("/badges/status/deploy.svg", nil)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Content-Type")).To(Equal("image/svg+xml"))
+		Expect(rec.Body.String()).To(ContainSubstring("deploy: running #4"))
+
+		rec = get("/badge.svg", nil)
+		Expect(rec.Body.String()).To(ContainSubstring("pipelines: failed"))
+
+		Expect(get("/badges/status/missing.svg", nil).Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("serves Prometheus metrics", func() {
+		rec := get("/metrics", nil)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Content-Type")).To(HavePrefix("text/plain; version=0.0.4"))
+		Expect(rec.Body.String()).To(ContainSubstring(
+			`pipeline_status_seconds_since_modified{key="status/deploy.yml",team="main",pipeline="deploy"} 3600`))
+	})
+
+	It("reports unknown paths and methods", func() {
+		Expect(get("/missing", nil).Code).To(Equal(http.StatusNotFound))
+
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest("POST", "/", nil))
+		Expect(rec.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
+
+type failingService struct {
+	*driver.MemoryServicer
+}
+
+func (f failingService) ListObjectsV2(input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+	return nil, fmt.Errorf("AccessDenied: %s", aws.StringValue(input.Bucket))
+}
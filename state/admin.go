@@ -0,0 +1,62 @@
+package state
+
+import (
+	"time"
+
+	"github.com/pivotalservices/pipeline-status-resource/models"
+)
+
+// maxHistory bounds the number of events kept on a status.
+const maxHistory = 50
+
+// ForceReady returns a copy of the status moved straight to READY, whatever
+// state it was in and whoever held it. The previous state and holders are
+// recorded in the status history along with the reason.
+func ForceReady(status *models.PipelineStatus,
+	by models.BuildIdentity,
+	reason string,
+	now time.Time) *models.PipelineStatus {
+
+	newStatus := &models.PipelineStatus{}
+	*newStatus = *status
+
+	holders := append([]models.BuildIdentity{}, status.Holders...)
+	if status.Holder != nil {
+		holders = append(holders, *status.Holder)
+	}
+
+	newStatus.State = models.StateReady
+	newStatus.Failure = nil
+	newStatus.Holder = nil
+	newStatus.Holders = nil
+	if status.State == models.StateRunning {
+		recordRunEnd(newStatus, now)
+	}
+	modifyStatus(newStatus, now)
+
+	return AppendHistory(newStatus, models.StatusEvent{
+		Time:    now.Format(models.ISO8601DateFormat),
+		Action:  models.ForceReady,
+		By:      by,
+		From:    status.State,
+		To:      models.StateReady,
+		Holders: holders,
+		Reason:  reason,
+	})
+}
+
+// AppendHistory returns a copy of the status with the event added to its
+// history, dropping the oldest events once the history is full.
+func AppendHistory(status *models.PipelineStatus, event models.StatusEvent) *models.PipelineStatus {
+	newStatus := &models.PipelineStatus{}
+	*newStatus = *status
+
+	history := append([]models.StatusEvent{}, status.History...)
+	history = append(history, event)
+	if len(history) > maxHistory {
+		history = history[len(history)-maxHistory:]
+	}
+	newStatus.History = history
+
+	return newStatus
+}
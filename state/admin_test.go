@@ -0,0 +1,49 @@
+package state_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/state"
+)
+
+var _ = Describe("Admin actions", func() {
+	admin := models.BuildIdentity{Team: "ops", Pipeline: "admin", Job: "unlock", Build: "3"}
+	holder := models.BuildIdentity{Team: "t", Pipeline: "deploy", Job: "deploy", Build: "9"}
+	now := time.Date(2017, 9, 18, 10, 0, 0, 0, time.UTC)
+
+	It("forces a running status to ready and records who held it", func() {
+		status := &models.PipelineStatus{
+			BuildNumber: "9",
+			State:       models.StateRunning,
+			Holder:      &holder,
+		}
+
+		newStatus := state.ForceReady(status, admin, "worker died", now)
+		Expect(newStatus.State).To(Equal(models.StateReady))
+		Expect(newStatus.Holder).To(BeNil())
+		Expect(newStatus.BuildNumber).To(Equal("9"))
+		Expect(newStatus.History).To(Equal([]models.StatusEvent{{
+			Time:    "2017-09-18T10:00:00+0000",
+			Action:  models.ForceReady,
+			By:      admin,
+			From:    models.StateRunning,
+			To:      models.StateReady,
+			Holders: []models.BuildIdentity{holder},
+			Reason:  "worker died",
+		}}))
+		Expect(status.History).To(BeEmpty())
+	})
+
+	It("keeps a bounded history", func() {
+		status := &models.PipelineStatus{}
+		for i := 0; i < 60; i++ {
+			status = state.AppendHistory(status, models.StatusEvent{Reason: string(rune('a' + i%26))})
+		}
+
+		Expect(status.History).To(HaveLen(50))
+		Expect(status.History[49].Reason).To(Equal("h"))
+	})
+})
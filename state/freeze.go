@@ -0,0 +1,98 @@
+package state
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pivotalservices/pipeline-status-resource/models"
+)
+
+// Freeze returns a copy of the status frozen by the given build at the given
+// time. A zero expiry freezes the status until it is explicitly unfrozen.
+func Freeze(status *models.PipelineStatus,
+	frozenBy models.BuildIdentity,
+	reason string,
+	expires time.Time,
+	now time.Time) *models.PipelineStatus {
+
+	newStatus := &models.PipelineStatus{}
+	*newStatus = *status
+
+	freeze := &models.PipelineFreeze{
+		FrozenBy: frozenBy,
+		FrozenAt: now.Format(models.ISO8601DateFormat),
+		Reason:   reason,
+	}
+	if !expires.IsZero() {
+		freeze.Expires = expires.Format(models.ISO8601DateFormat)
+	}
+
+	newStatus.Freeze = freeze
+	modifyStatus(newStatus, now)
+
+	return newStatus
+}
+
+// Unfreeze returns a copy of the status with any freeze lifted at the given
+// time.
+func Unfreeze(status *models.PipelineStatus, now time.Time) *models.PipelineStatus {
+	newStatus := &models.PipelineStatus{}
+	*newStatus = *status
+
+	if newStatus.Freeze != nil {
+		newStatus.Freeze = nil
+		modifyStatus(newStatus, now)
+	}
+
+	return newStatus
+}
+
+// IsFrozen reports whether the status carries a freeze that has not expired
+// at the given time.
+func IsFrozen(status *models.PipelineStatus, now time.Time) bool {
+	if status == nil || status.Freeze == nil {
+		return false
+	}
+
+	if status.Freeze.Expires == "" {
+		return true
+	}
+
+	expires, err := time.Parse(models.ISO8601DateFormat, status.Freeze.Expires)
+	if err != nil {
+		return true
+	}
+
+	return now.Before(expires)
+}
+
+// DescribeFreeze returns a human readable summary of who froze the status
+// and why.
+func DescribeFreeze(freeze *models.PipelineFreeze) string {
+	if freeze == nil {
+		return "not frozen"
+	}
+
+	desc := fmt.Sprintf("frozen by %s since %s", DescribeBuild(freeze.FrozenBy), freeze.FrozenAt)
+	if freeze.Expires != "" {
+		desc += fmt.Sprintf(" until %s", freeze.Expires)
+	}
+	if freeze.Reason != "" {
+		desc += fmt.Sprintf(": %s", freeze.Reason)
+	}
+
+	return desc
+}
+
+// DescribeBuild formats a build identity as team/pipeline/job #build.
+func DescribeBuild(build models.BuildIdentity) string {
+	desc := fmt.Sprintf("%s/%s", build.Team, build.Pipeline)
+	if build.Job != "" {
+		desc += "/" + build.Job
+	}
+	if build.Build != "" {
+		desc += " #" + build.Build
+	}
+
+	return desc
+}
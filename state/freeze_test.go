@@ -0,0 +1,47 @@
+package state_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/state"
+)
+
+var _ = Describe("Freeze", func() {
+	var status *models.PipelineStatus
+	var frozenBy models.BuildIdentity
+
+	BeforeEach(func() {
+		status = &models.PipelineStatus{
+			BuildNumber: "3",
+			State:       models.StateReady,
+		}
+		frozenBy = models.BuildIdentity{Team: "ops", Pipeline: "freezer", Job: "freeze", Build: "12"}
+	})
+
+	It("is not frozen without a freeze", func() {
+		Expect(state.IsFrozen(status, time.Now())).To(BeFalse())
+	})
+
+	It("stays frozen without an expiry", func() {
+		frozen := state.Freeze(status, frozenBy, "release", time.Time{}, time.Now())
+		Expect(state.IsFrozen(frozen, time.Now().Add(24*time.Hour))).To(BeTrue())
+		Expect(state.DescribeFreeze(frozen.Freeze)).To(HavePrefix("frozen by ops/freezer/freeze #12 since"))
+		Expect(state.DescribeFreeze(frozen.Freeze)).To(HaveSuffix(": release"))
+	})
+
+	It("thaws once the expiry has passed", func() {
+		now := time.Now()
+		frozen := state.Freeze(status, frozenBy, "", now.Add(time.Hour), now)
+		Expect(state.IsFrozen(frozen, now)).To(BeTrue())
+		Expect(state.IsFrozen(frozen, now.Add(2*time.Hour))).To(BeFalse())
+	})
+
+	It("does not change the original status", func() {
+		state.Freeze(status, frozenBy, "", time.Time{}, time.Now())
+		Expect(status.Freeze).To(BeNil())
+		Expect(state.Unfreeze(state.Freeze(status, frozenBy, "", time.Time{}, time.Now()), time.Now()).Freeze).To(BeNil())
+	})
+})
@@ -0,0 +1,101 @@
+package state
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/pivotalservices/pipeline-status-resource/models"
+)
+
+// GateCondition is what a gate requires of the status it waits on.
+type GateCondition string
+
+const (
+	// GateReady requires the status to be READY without a failure.
+	GateReady GateCondition = "ready"
+	// GatePassed requires the status to have finished the given build
+	// without a failure, or to have started a later one.
+	GatePassed GateCondition = "passed"
+)
+
+// Gate is a condition on another pipeline's status.
+type Gate struct {
+	Condition GateCondition
+	Build     int
+}
+
+// NewGate parses a gate condition. The condition defaults to ready, and
+// the passed condition requires a build number.
+func NewGate(condition GateCondition, build string) (*Gate, error) {
+	gate := &Gate{Condition: condition}
+
+	switch condition {
+	case "":
+		gate.Condition = GateReady
+	case GateReady:
+	case GatePassed:
+		var err error
+		if gate.Build, err = strconv.Atoi(build); err != nil {
+			return nil, fmt.Errorf("the %s condition needs a build number, got %q", GatePassed, build)
+		}
+	default:
+		return nil, fmt.Errorf("unknown condition %s, expected %s or %s", condition, GateReady, GatePassed)
+	}
+
+	return gate, nil
+}
+
+// Blocked reports whether the status does not meet the gate's condition
+// and, if so, why.
+func (g *Gate) Blocked(status *models.PipelineStatus) (reason string, blocked bool) {
+	build, _ := strconv.Atoi(status.BuildNumber)
+
+	if g.Condition == GatePassed {
+		switch {
+		case build > g.Build:
+			return "", false
+		case build < g.Build:
+			return fmt.Sprintf("pipeline %s is at build %d, waiting for build %d to pass",
+				status.Pipeline, build, g.Build), true
+		}
+	}
+
+	if reason, blocked = DependencyBlocked(status); blocked {
+		return reason, true
+	}
+
+	if status.State != models.StateReady && status.State != "" {
+		return fmt.Sprintf("pipeline %s is %s", status.Pipeline, status.State), true
+	}
+
+	return "", false
+}
+
+// DependencyBlocked reports whether the status keeps the pipelines that
+// depend on it from starting, because it is running or has a recorded
+// failure, and if so why.
+func DependencyBlocked(status *models.PipelineStatus) (reason string, blocked bool) {
+	switch {
+	case status.State == models.StateRunning:
+		reason = fmt.Sprintf("pipeline %s is running build %s", status.Pipeline, status.BuildNumber)
+		if holders := statusHolders(status); len(holders) > 0 {
+			reason += " for " + DescribeBuilds(holders)
+		}
+		return reason, true
+	case status.Failure != nil:
+		return fmt.Sprintf("pipeline %s failed in job %s build %s, see %s", status.Pipeline,
+			status.Failure.JobName, status.Failure.BuildName, status.Failure.DetailsURL), true
+	}
+
+	return "", false
+}
+
+func statusHolders(status *models.PipelineStatus) []models.BuildIdentity {
+	var holders []models.BuildIdentity
+	holders = append(holders, status.Holders...)
+	if status.Holder != nil {
+		holders = append(holders, *status.Holder)
+	}
+
+	return holders
+}
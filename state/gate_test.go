@@ -0,0 +1,60 @@
+package state_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/state"
+)
+
+var _ = Describe("Gates", func() {
+	holder := models.BuildIdentity{Team: "t", Pipeline: "deploy", Job: "deploy", Build: "9"}
+	failure := &models.BuildFailure{JobName: "deploy", BuildName: "8", DetailsURL: "https://ci/8"}
+
+	status := func(build string, pipelineState models.PipelineState, failure *models.BuildFailure) *models.PipelineStatus {
+		s := &models.PipelineStatus{
+			Pipeline:    "deploy",
+			BuildNumber: build,
+			State:       pipelineState,
+			Failure:     failure,
+		}
+		if pipelineState == models.StateRunning {
+			s.Holder = &holder
+		}
+		return s
+	}
+
+	DescribeTable("blocking",
+		func(condition state.GateCondition, build string, s *models.PipelineStatus, reason string) {
+			gate, err := state.NewGate(condition, build)
+			Expect(err).NotTo(HaveOccurred())
+
+			actual, blocked := gate.Blocked(s)
+			Expect(blocked).To(Equal(reason != ""))
+			Expect(actual).To(Equal(reason))
+		},
+		Entry("ready passes a ready status", state.GateReady, "", status("9", models.StateReady, nil), ""),
+		Entry("ready is the default", state.GateCondition(""), "", status("9", models.StateReady, nil), ""),
+		Entry("ready blocks a running status", state.GateReady, "", status("9", models.StateRunning, nil),
+			"pipeline deploy is running build 9 for t/deploy/deploy #9"),
+		Entry("ready blocks a failed status", state.GateReady, "", status("8", models.StateReady, failure),
+			"pipeline deploy failed in job deploy build 8, see https://ci/8"),
+		Entry("ready blocks other states", state.GateReady, "", status("8", "PAUSED", nil),
+			"pipeline deploy is PAUSED"),
+		Entry("passed blocks earlier builds", state.GatePassed, "9", status("8", models.StateReady, nil),
+			"pipeline deploy is at build 8, waiting for build 9 to pass"),
+		Entry("passed blocks the build while it runs", state.GatePassed, "9", status("9", models.StateRunning, nil),
+			"pipeline deploy is running build 9 for t/deploy/deploy #9"),
+		Entry("passed passes the build once it is ready", state.GatePassed, "9", status("9", models.StateReady, nil), ""),
+		Entry("passed passes later builds", state.GatePassed, "9", status("10", models.StateRunning, nil), ""),
+	)
+
+	It("validates the condition", func() {
+		_, err := state.NewGate(state.GatePassed, "")
+		Expect(err).To(MatchError(`the passed condition needs a build number, got ""`))
+
+		_, err = state.NewGate("green", "")
+		Expect(err).To(MatchError("unknown condition green, expected ready or passed"))
+	})
+})
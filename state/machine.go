@@ -0,0 +1,143 @@
+package state
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pivotalservices/pipeline-status-resource/clock"
+	"github.com/pivotalservices/pipeline-status-resource/logger"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+)
+
+// Machine holds the set of known pipeline states and the transitions
+// allowed between them. Clock stamps modified statuses and defaults to the
+// system clock. Log records the transitions made.
+type Machine struct {
+	Clock clock.Clock
+	Log   *logger.Logger
+
+	states      map[models.PipelineState]bool
+	transitions map[models.PipelineState]map[models.PipelineState]bool
+}
+
+var defaultTransitions = []models.StateTransition{
+	{From: []models.PipelineState{"", models.StateReady}, To: models.StateRunning},
+	{From: []models.PipelineState{models.StateRunning}, To: models.StateReady},
+}
+
+// NewMachine builds a state machine containing the built-in READY and
+// RUNNING states and their transitions, extended with the given states and
+// transitions. Transitions may only reference known states.
+func NewMachine(states []models.PipelineState, transitions []models.StateTransition) (*Machine, error) {
+	m := &Machine{
+		states: map[models.PipelineState]bool{
+			models.StateReady:   true,
+			models.StateRunning: true,
+		},
+		transitions: map[models.PipelineState]map[models.PipelineState]bool{},
+	}
+
+	for _, s := range states {
+		if s == "" {
+			return nil, fmt.Errorf("State names cannot be empty")
+		}
+		m.states[s] = true
+	}
+
+	for _, t := range defaultTransitions {
+		m.allow(t)
+	}
+
+	for _, t := range transitions {
+		if !m.states[t.To] {
+			return nil, fmt.Errorf("Transition to unknown state %s", t.To)
+		}
+		if len(t.From) == 0 {
+			return nil, fmt.Errorf("Transition to state %s does not list any states to move from", t.To)
+		}
+		for _, from := range t.From {
+			if !m.states[from] {
+				return nil, fmt.Errorf("Transition to state %s is from unknown state %s", t.To, from)
+			}
+		}
+		m.allow(t)
+	}
+
+	return m, nil
+}
+
+// FromSource builds the state machine described by the source configuration.
+func FromSource(source models.Source) (*Machine, error) {
+	return NewMachine(source.States, source.Transitions)
+}
+
+// Default returns a state machine with only the built-in states.
+func Default() *Machine {
+	m, _ := NewMachine(nil, nil)
+	return m
+}
+
+func (m *Machine) now() time.Time {
+	if m.Clock == nil {
+		return time.Now()
+	}
+
+	return m.Clock.Now()
+}
+
+func (m *Machine) allow(t models.StateTransition) {
+	for _, from := range t.From {
+		if m.transitions[from] == nil {
+			m.transitions[from] = map[models.PipelineState]bool{}
+		}
+		m.transitions[from][t.To] = true
+	}
+}
+
+// IsKnown reports whether the state is one the machine knows about.
+func (m *Machine) IsKnown(s models.PipelineState) bool {
+	return m.states[s]
+}
+
+// CanTransition reports whether a status may move between the two states.
+// Staying in the same state is always allowed.
+func (m *Machine) CanTransition(from, to models.PipelineState) bool {
+	return from == to || m.transitions[from][to]
+}
+
+// CheckTransition returns a descriptive error if a status cannot move
+// between the two states.
+func (m *Machine) CheckTransition(from, to models.PipelineState) error {
+	if !m.states[to] {
+		return fmt.Errorf("Unknown state %s, known states are: %s", to, m.describe(m.states))
+	}
+
+	if m.CanTransition(from, to) {
+		return nil
+	}
+
+	name := string(from)
+	if name == "" {
+		name = "a new status"
+	}
+
+	if len(m.transitions[from]) == 0 {
+		return fmt.Errorf("Cannot transition pipeline from %s to %s, no transitions are allowed from %s",
+			name, to, name)
+	}
+
+	return fmt.Errorf("Cannot transition pipeline from %s to %s, allowed states from %s are: %s",
+		name, to, name, m.describe(m.transitions[from]))
+}
+
+func (m *Machine) describe(states map[models.PipelineState]bool) string {
+	names := make([]string, 0, len(states))
+	for s := range states {
+		names = append(names, string(s))
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,90 @@
+package state_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/state"
+)
+
+var _ = Describe("State Machine", func() {
+	var status *models.PipelineStatus
+
+	BeforeEach(func() {
+		status = &models.PipelineStatus{
+			BuildNumber: "3",
+			State:       models.StateReady,
+		}
+	})
+
+	Context("with the built-in states", func() {
+		It("starts a ready pipeline", func() {
+			newStatus, err := state.ChangeState(status, models.StateRunning, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(newStatus.State).To(Equal(models.StateRunning))
+			Expect(newStatus.BuildNumber).To(Equal("4"))
+		})
+
+		It("leaves the status alone when the state does not change", func() {
+			newStatus, err := state.ChangeState(status, models.StateReady, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*newStatus).To(Equal(*status))
+		})
+
+		It("rejects unknown states", func() {
+			_, err := state.ChangeState(status, "PAUSED", nil)
+			Expect(err).To(MatchError(ContainSubstring("Unknown state PAUSED")))
+		})
+	})
+
+	Context("with custom states", func() {
+		var machine *state.Machine
+
+		BeforeEach(func() {
+			var err error
+			machine, err = state.NewMachine(
+				[]models.PipelineState{"PAUSED"},
+				[]models.StateTransition{
+					{From: []models.PipelineState{models.StateReady}, To: "PAUSED"},
+					{From: []models.PipelineState{"PAUSED"}, To: models.StateReady},
+				})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("allows declared transitions", func() {
+			newStatus, err := machine.ChangeState(status, "PAUSED", nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(newStatus.State).To(Equal(models.PipelineState("PAUSED")))
+			Expect(newStatus.BuildNumber).To(Equal("3"))
+			Expect(newStatus.LastModified).NotTo(BeEmpty())
+		})
+
+		It("rejects transitions that were not declared", func() {
+			status.State = "PAUSED"
+			_, err := machine.ChangeState(status, models.StateRunning, nil)
+			Expect(err).To(MatchError("Cannot transition pipeline from PAUSED to RUNNING, allowed states from PAUSED are: READY"))
+		})
+
+		It("keeps the built-in transitions", func() {
+			Expect(machine.CanTransition(models.StateReady, models.StateRunning)).To(BeTrue())
+			Expect(machine.CanTransition(models.StateRunning, models.StateReady)).To(BeTrue())
+			Expect(machine.CanTransition(models.StateRunning, "PAUSED")).To(BeFalse())
+		})
+	})
+
+	Context("with an invalid configuration", func() {
+		It("rejects transitions to undeclared states", func() {
+			_, err := state.NewMachine(nil, []models.StateTransition{
+				{From: []models.PipelineState{models.StateReady}, To: "FROZEN"},
+			})
+			Expect(err).To(MatchError("Transition to unknown state FROZEN"))
+		})
+
+		It("rejects transitions from undeclared states", func() {
+			_, err := state.NewMachine([]models.PipelineState{"FROZEN"}, []models.StateTransition{
+				{From: []models.PipelineState{"BLOCKED"}, To: "FROZEN"},
+			})
+			Expect(err).To(MatchError("Transition to state FROZEN is from unknown state BLOCKED"))
+		})
+	})
+})
@@ -7,31 +7,58 @@ import (
 	"github.com/pivotalservices/pipeline-status-resource/models"
 )
 
+// ChangeState moves the status to the given state using the built-in
+// state machine.
 func ChangeState(status *models.PipelineStatus,
 	buildState models.PipelineState,
 	failure *models.BuildFailure) (newStatus *models.PipelineStatus, err error) {
+	return Default().ChangeState(status, buildState, failure)
+}
+
+// ChangeState moves the status to the given state, returning an error if the
+// machine does not allow the transition. Moving to the current state leaves
+// the status untouched. The holder or slot holders of a status are kept
+// when it starts running and cleared when it moves to any other state.
+func (m *Machine) ChangeState(status *models.PipelineStatus,
+	buildState models.PipelineState,
+	failure *models.BuildFailure) (newStatus *models.PipelineStatus, err error) {
+
+	if err = m.CheckTransition(status.State, buildState); err != nil {
+		return nil, err
+	}
 
 	newStatus = &models.PipelineStatus{}
 	*newStatus = *status
 
+	if status.State != buildState {
+		m.Log.Debug("Changing state", "pipeline", status.Pipeline, "from", status.State, "to", buildState)
+	}
+
 	switch {
-	case buildState == models.StateRunning && newStatus.State != models.StateRunning:
+	case newStatus.State == buildState:
+	case buildState == models.StateRunning:
 		buildNum, _ := strconv.Atoi(status.BuildNumber)
 
 		newStatus.State = buildState
 		newStatus.BuildNumber = strconv.Itoa(buildNum + 1)
 		newStatus.Failure = nil
-		modifyStatus(newStatus)
-	case buildState == models.StateReady && newStatus.State != models.StateReady:
+		recordRunStart(newStatus, m.now())
+		modifyStatus(newStatus, m.now())
+	default:
 		newStatus.State = buildState
 		newStatus.Failure = failure
-		modifyStatus(newStatus)
+		newStatus.Holder = nil
+		newStatus.Holders = nil
+		if status.State == models.StateRunning {
+			recordRunEnd(newStatus, m.now())
+		}
+		recordOutcome(newStatus, buildState, failure)
+		modifyStatus(newStatus, m.now())
 	}
 
 	return
 }
 
-func modifyStatus(s *models.PipelineStatus) {
-	now := time.Now()
+func modifyStatus(s *models.PipelineStatus, now time.Time) {
 	s.LastModified = now.Format(models.ISO8601DateFormat)
 }
@@ -0,0 +1,87 @@
+package state
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pivotalservices/pipeline-status-resource/models"
+)
+
+// NewTicket returns a ticket for the build, first queued at the given time
+// with the given priority and last seen now.
+func NewTicket(build models.BuildIdentity, priority int, enqueued time.Time, now time.Time) models.QueueTicket {
+	return models.QueueTicket{
+		Build:    build,
+		Priority: priority,
+		Enqueued: enqueued.Format(models.ISO8601DateFormat),
+		Seen:     now.Format(models.ISO8601DateFormat),
+	}
+}
+
+// PruneQueue returns the tickets that have been seen within the timeout, in
+// priority and arrival order. The given tickets are left untouched.
+func PruneQueue(queue []models.QueueTicket, timeout time.Duration, now time.Time) []models.QueueTicket {
+	pruned := []models.QueueTicket{}
+
+	for _, t := range queue {
+		seen, err := time.Parse(models.ISO8601DateFormat, t.Seen)
+		if err == nil && now.Sub(seen) <= timeout {
+			pruned = append(pruned, t)
+		}
+	}
+
+	sortQueue(pruned)
+
+	return pruned
+}
+
+// QueuePosition returns how many tickets are ahead of the build's ticket in
+// a sorted queue. A build without a ticket is behind every queued build.
+func QueuePosition(queue []models.QueueTicket, build models.BuildIdentity) int {
+	if i := ticketIndex(queue, build); i >= 0 {
+		return i
+	}
+
+	return len(queue)
+}
+
+// HigherPriorityWaiters returns how many tickets have a higher priority than
+// the build's own ticket, or than the default priority of zero when the
+// build has no ticket.
+func HigherPriorityWaiters(queue []models.QueueTicket, build models.BuildIdentity) int {
+	priority := 0
+	if i := ticketIndex(queue, build); i >= 0 {
+		priority = queue[i].Priority
+	}
+
+	count := 0
+	for _, t := range queue {
+		if t.Priority > priority {
+			count++
+		}
+	}
+
+	return count
+}
+
+func ticketIndex(queue []models.QueueTicket, build models.BuildIdentity) int {
+	for i, t := range queue {
+		if t.Build == build {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func sortQueue(queue []models.QueueTicket) {
+	sort.SliceStable(queue, func(i, j int) bool {
+		if queue[i].Priority != queue[j].Priority {
+			return queue[i].Priority > queue[j].Priority
+		}
+
+		a, _ := time.Parse(models.ISO8601DateFormat, queue[i].Enqueued)
+		b, _ := time.Parse(models.ISO8601DateFormat, queue[j].Enqueued)
+		return a.Before(b)
+	})
+}
@@ -0,0 +1,79 @@
+package state_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/state"
+)
+
+var _ = Describe("Queue", func() {
+	var now time.Time
+
+	first := models.BuildIdentity{Team: "t", Pipeline: "p", Job: "deploy", Build: "1"}
+	second := models.BuildIdentity{Team: "t", Pipeline: "p", Job: "deploy", Build: "2"}
+
+	BeforeEach(func() {
+		now = time.Date(2017, 9, 18, 10, 0, 0, 0, time.UTC)
+	})
+
+	It("orders tickets by when they were first queued", func() {
+		queue := state.PruneQueue([]models.QueueTicket{
+			state.NewTicket(second, 0, now, now),
+			state.NewTicket(first, 0, now.Add(-time.Second), now),
+		}, time.Minute, now)
+
+		Expect(state.QueuePosition(queue, first)).To(Equal(0))
+		Expect(state.QueuePosition(queue, second)).To(Equal(1))
+	})
+
+	It("keeps a build's place when its ticket is refreshed", func() {
+		later := now.Add(30 * time.Second)
+		queue := state.PruneQueue([]models.QueueTicket{
+			state.NewTicket(second, 0, now.Add(time.Second), now.Add(time.Second)),
+			state.NewTicket(first, 0, now, later),
+		}, time.Minute, later)
+
+		Expect(queue).To(HaveLen(2))
+		Expect(state.QueuePosition(queue, first)).To(Equal(0))
+		Expect(queue[0].Seen).To(Equal("2017-09-18T10:00:30+0000"))
+	})
+
+	It("drops tickets that have not been seen within the timeout", func() {
+		later := now.Add(2 * time.Minute)
+		queue := state.PruneQueue([]models.QueueTicket{
+			state.NewTicket(first, 0, now, now),
+			state.NewTicket(second, 0, later, later),
+		}, time.Minute, later)
+
+		Expect(queue).To(HaveLen(1))
+		Expect(state.QueuePosition(queue, second)).To(Equal(0))
+	})
+
+	It("puts higher priority tickets first", func() {
+		queue := state.PruneQueue([]models.QueueTicket{
+			state.NewTicket(first, 0, now, now),
+			state.NewTicket(second, 10, now.Add(time.Second), now),
+		}, time.Minute, now)
+
+		Expect(state.QueuePosition(queue, second)).To(Equal(0))
+		Expect(state.QueuePosition(queue, first)).To(Equal(1))
+	})
+
+	It("counts the waiters with a higher priority", func() {
+		queue := []models.QueueTicket{state.NewTicket(first, 5, now, now)}
+		Expect(state.HigherPriorityWaiters(queue, first)).To(Equal(0))
+		Expect(state.HigherPriorityWaiters(queue, second)).To(Equal(1))
+
+		queue = append(queue, state.NewTicket(second, 5, now, now))
+		Expect(state.HigherPriorityWaiters(queue, second)).To(Equal(0))
+	})
+
+	It("puts builds without a ticket behind the queue", func() {
+		queue := []models.QueueTicket{state.NewTicket(first, 0, now, now)}
+		Expect(state.QueuePosition(queue, second)).To(Equal(1))
+		Expect(state.QueuePosition(nil, second)).To(Equal(0))
+	})
+})
@@ -0,0 +1,160 @@
+package state
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pivotalservices/pipeline-status-resource/models"
+)
+
+// Acquire takes one of the status' slots for the holder, moving the status
+// to RUNNING if it was not already. Each acquired slot is given a new build
+// number. Acquiring a slot the holder already has leaves the status
+// untouched.
+func (m *Machine) Acquire(status *models.PipelineStatus,
+	holder models.BuildIdentity,
+	slots int) (newStatus *models.PipelineStatus, err error) {
+
+	if slotIndex(status.Holders, holder) >= 0 {
+		newStatus = &models.PipelineStatus{}
+		*newStatus = *status
+		return newStatus, nil
+	}
+
+	if !HasFreeSlot(status, slots) {
+		return nil, fmt.Errorf("All %d slots are taken by %s", slots, DescribeBuilds(status.Holders))
+	}
+
+	if status.State != models.StateRunning {
+		if newStatus, err = m.ChangeState(status, models.StateRunning, nil); err != nil {
+			return nil, err
+		}
+	} else {
+		newStatus = &models.PipelineStatus{}
+		*newStatus = *status
+
+		buildNum, _ := strconv.Atoi(status.BuildNumber)
+		newStatus.BuildNumber = strconv.Itoa(buildNum + 1)
+		recordRunStart(newStatus, m.now())
+		modifyStatus(newStatus, m.now())
+	}
+
+	newStatus.Holder = nil
+	newStatus.Holders = append(append([]models.BuildIdentity{}, status.Holders...), holder)
+	m.Log.Debug("Took slot", "holder", DescribeBuild(holder), "taken", len(newStatus.Holders), "slots", slots)
+
+	return newStatus, nil
+}
+
+// Release frees the holder's slot, moving the status to READY once no slots
+// remain taken.
+func (m *Machine) Release(status *models.PipelineStatus,
+	holder models.BuildIdentity,
+	failure *models.BuildFailure) (newStatus *models.PipelineStatus, err error) {
+
+	i := slotIndex(status.Holders, holder)
+	if i < 0 {
+		return nil, fmt.Errorf("%s does not hold a slot, slots are held by %s",
+			DescribeBuild(holder), DescribeBuilds(status.Holders))
+	}
+
+	holders := append([]models.BuildIdentity{}, status.Holders[:i]...)
+	holders = append(holders, status.Holders[i+1:]...)
+	m.Log.Debug("Released slot", "holder", DescribeBuild(status.Holders[i]), "taken", len(holders))
+
+	if len(holders) == 0 {
+		return m.ChangeState(status, models.StateReady, failure)
+	}
+
+	newStatus = &models.PipelineStatus{}
+	*newStatus = *status
+	newStatus.Holders = holders
+	if failure != nil {
+		newStatus.Failure = failure
+	}
+	modifyStatus(newStatus, m.now())
+
+	return newStatus, nil
+}
+
+// IsOwner reports whether the build started the status' current run, or
+// holds one of its slots. Builds are compared by their Concourse build IDs
+// when both have one. Statuses that are not running, or were started
+// without recording a holder, have no owner and can be finished by anyone.
+func IsOwner(status *models.PipelineStatus, build models.BuildIdentity) bool {
+	return isOwnedBy(status, func(holder models.BuildIdentity) bool {
+		return SameBuild(holder, build)
+	})
+}
+
+// IsPipelineOwner is like IsOwner, but lets any job or build of the team and
+// pipeline that started the run own it.
+func IsPipelineOwner(status *models.PipelineStatus, build models.BuildIdentity) bool {
+	return isOwnedBy(status, func(holder models.BuildIdentity) bool {
+		return holder.Team == build.Team && holder.Pipeline == build.Pipeline
+	})
+}
+
+func isOwnedBy(status *models.PipelineStatus, owns func(models.BuildIdentity) bool) bool {
+	if status.State != models.StateRunning {
+		return true
+	}
+
+	if status.Holder == nil && len(status.Holders) == 0 {
+		return true
+	}
+
+	for _, h := range statusHolders(status) {
+		if owns(h) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SameBuild reports whether the identities name the same build, by their
+// Concourse build IDs when both have one.
+func SameBuild(a, b models.BuildIdentity) bool {
+	if a.ID != "" && b.ID != "" {
+		return a.ID == b.ID
+	}
+
+	return a.Team == b.Team && a.Pipeline == b.Pipeline && a.Job == b.Job && a.Build == b.Build
+}
+
+// HasFreeSlot reports whether a status with the given number of slots can
+// be started.
+func HasFreeSlot(status *models.PipelineStatus, slots int) bool {
+	if status.State != models.StateRunning {
+		return true
+	}
+
+	return len(status.Holders) < slots
+}
+
+func slotIndex(holders []models.BuildIdentity, holder models.BuildIdentity) int {
+	for i, h := range holders {
+		if SameBuild(h, holder) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// DescribeBuilds formats build identities like DescribeBuild, separated by
+// commas, or as nobody when there are none.
+func DescribeBuilds(builds []models.BuildIdentity) string {
+	if len(builds) == 0 {
+		return "nobody"
+	}
+
+	names := make([]string, 0, len(builds))
+	for _, b := range builds {
+		names = append(names, DescribeBuild(b))
+	}
+
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,150 @@
+package state_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/state"
+)
+
+var _ = Describe("Semaphore", func() {
+	var machine *state.Machine
+	var status *models.PipelineStatus
+
+	first := models.BuildIdentity{Team: "t", Pipeline: "deploy-a", Job: "deploy", Build: "1"}
+	second := models.BuildIdentity{Team: "t", Pipeline: "deploy-b", Job: "deploy", Build: "7"}
+	third := models.BuildIdentity{Team: "t", Pipeline: "deploy-c", Job: "deploy", Build: "2"}
+
+	BeforeEach(func() {
+		machine = state.Default()
+		status = &models.PipelineStatus{BuildNumber: "3", State: models.StateReady}
+	})
+
+	It("fills slots up to the limit", func() {
+		status, err := machine.Acquire(status, first, 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.State).To(Equal(models.StateRunning))
+		Expect(status.BuildNumber).To(Equal("4"))
+
+		status, err = machine.Acquire(status, second, 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.BuildNumber).To(Equal("5"))
+		Expect(status.Holders).To(Equal([]models.BuildIdentity{first, second}))
+		Expect(state.HasFreeSlot(status, 2)).To(BeFalse())
+
+		_, err = machine.Acquire(status, third, 2)
+		Expect(err).To(MatchError("All 2 slots are taken by t/deploy-a/deploy #1, t/deploy-b/deploy #7"))
+	})
+
+	It("frees every slot when the status leaves RUNNING another way", func() {
+		machine, err := state.NewMachine([]models.PipelineState{"BLOCKED"}, []models.StateTransition{
+			{From: []models.PipelineState{models.StateRunning}, To: "BLOCKED"},
+			{From: []models.PipelineState{"BLOCKED"}, To: models.StateReady},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		status, _ := machine.Acquire(status, first, 2)
+		status, _ = machine.Acquire(status, second, 2)
+
+		status, err = machine.ChangeState(status, "BLOCKED", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Holders).To(BeEmpty())
+
+		status, _ = machine.ChangeState(status, models.StateReady, nil)
+		status, err = machine.Acquire(status, third, 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Holders).To(Equal([]models.BuildIdentity{third}))
+	})
+
+	It("does not take a second slot for the same build", func() {
+		status, _ := machine.Acquire(status, first, 2)
+		status, err := machine.Acquire(status, first, 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Holders).To(HaveLen(1))
+		Expect(status.BuildNumber).To(Equal("4"))
+	})
+
+	It("releases only the caller's slot", func() {
+		status, _ := machine.Acquire(status, first, 2)
+		status, _ = machine.Acquire(status, second, 2)
+
+		status, err := machine.Release(status, second, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.State).To(Equal(models.StateRunning))
+		Expect(status.Holders).To(Equal([]models.BuildIdentity{first}))
+
+		status, err = machine.Release(status, first, &models.BuildFailure{JobName: "deploy"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.State).To(Equal(models.StateReady))
+		Expect(status.Holders).To(BeEmpty())
+		Expect(status.Failure.JobName).To(Equal("deploy"))
+	})
+
+	It("refuses to release a slot held by another job of the same pipeline", func() {
+		status, _ := machine.Acquire(status, first, 2)
+
+		later := first
+		later.Job = "smoke-test"
+		_, err := machine.Release(status, later, nil)
+		Expect(err).To(MatchError("t/deploy-a/smoke-test #1 does not hold a slot, slots are held by t/deploy-a/deploy #1"))
+	})
+
+	It("refuses to release a slot the caller does not hold", func() {
+		status, _ := machine.Acquire(status, first, 2)
+
+		_, err := machine.Release(status, third, nil)
+		Expect(err).To(MatchError("t/deploy-c/deploy #2 does not hold a slot, slots are held by t/deploy-a/deploy #1"))
+	})
+
+	Describe("ownership", func() {
+		It("belongs to the build holding the run", func() {
+			status.State = models.StateRunning
+			status.Holder = &first
+
+			laterJob := first
+			laterJob.Job = "smoke-test"
+			Expect(state.IsOwner(status, first)).To(BeTrue())
+			Expect(state.IsOwner(status, laterJob)).To(BeFalse())
+			Expect(state.IsOwner(status, second)).To(BeFalse())
+		})
+
+		It("compares builds by their build IDs when both have one", func() {
+			holder := first
+			holder.ID = "1234"
+			status.State = models.StateRunning
+			status.Holder = &holder
+
+			renamed := holder
+			renamed.Build = "1.1"
+			Expect(state.IsOwner(status, renamed)).To(BeTrue())
+
+			other := holder
+			other.ID = "1235"
+			Expect(state.IsOwner(status, other)).To(BeFalse())
+		})
+
+		It("belongs to the pipeline holding the run when asked", func() {
+			status.State = models.StateRunning
+			status.Holder = &first
+
+			laterJob := first
+			laterJob.Job = "smoke-test"
+			Expect(state.IsPipelineOwner(status, laterJob)).To(BeTrue())
+			Expect(state.IsPipelineOwner(status, second)).To(BeFalse())
+		})
+
+		It("belongs to every pipeline holding a slot", func() {
+			status, _ := machine.Acquire(status, first, 2)
+			status, _ = machine.Acquire(status, second, 2)
+
+			Expect(state.IsOwner(status, first)).To(BeTrue())
+			Expect(state.IsOwner(status, second)).To(BeTrue())
+			Expect(state.IsOwner(status, third)).To(BeFalse())
+		})
+
+		It("has no owner when nobody holds it", func() {
+			status.State = models.StateRunning
+			Expect(state.IsOwner(status, third)).To(BeTrue())
+		})
+	})
+})
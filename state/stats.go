@@ -0,0 +1,64 @@
+package state
+
+import (
+	"time"
+
+	"github.com/pivotalservices/pipeline-status-resource/models"
+)
+
+// RecordLockWait returns a copy of the status recording how long the build
+// waited to start, from the given time until now. A zero time means the
+// build did not wait.
+func RecordLockWait(status *models.PipelineStatus, since time.Time, now time.Time) *models.PipelineStatus {
+	newStatus := &models.PipelineStatus{}
+	*newStatus = *status
+
+	if since.IsZero() {
+		return newStatus
+	}
+
+	wait := now.Sub(since).Seconds()
+	stats := copyStats(newStatus)
+	stats.LockWaitSeconds += wait
+	stats.LastLockWaitSeconds = wait
+
+	return newStatus
+}
+
+func recordRunStart(s *models.PipelineStatus, now time.Time) {
+	stats := copyStats(s)
+	stats.Runs++
+	if stats.RunStarted == "" {
+		stats.RunStarted = now.Format(models.ISO8601DateFormat)
+	}
+}
+
+func recordRunEnd(s *models.PipelineStatus, now time.Time) {
+	stats := copyStats(s)
+	if started, err := time.Parse(models.ISO8601DateFormat, stats.RunStarted); err == nil {
+		stats.LastRunSeconds = now.Sub(started).Seconds()
+	}
+	stats.RunStarted = ""
+}
+
+func recordOutcome(s *models.PipelineStatus, state models.PipelineState, failure *models.BuildFailure) {
+	stats := copyStats(s)
+	if failure != nil {
+		stats.Failures++
+		stats.ConsecutiveFailures++
+	} else if state == models.StateReady {
+		stats.ConsecutiveFailures = 0
+	}
+}
+
+// copyStats gives the status its own copy of its stats, so that changing
+// them leaves the status it was copied from untouched.
+func copyStats(s *models.PipelineStatus) *models.StatusStats {
+	stats := &models.StatusStats{}
+	if s.Stats != nil {
+		*stats = *s.Stats
+	}
+	s.Stats = stats
+
+	return stats
+}
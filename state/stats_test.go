@@ -0,0 +1,71 @@
+package state_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotalservices/pipeline-status-resource/clock"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/state"
+)
+
+var _ = Describe("Stats", func() {
+	start := time.Date(2017, 9, 18, 10, 0, 0, 0, time.UTC)
+	failure := &models.BuildFailure{JobName: "deploy", BuildName: "4"}
+
+	run := func(status *models.PipelineStatus, minutes int, failure *models.BuildFailure) *models.PipelineStatus {
+		m := state.Default()
+		m.Clock = clock.Fixed(start)
+		running, err := m.ChangeState(status, models.StateRunning, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		m.Clock = clock.Fixed(start.Add(time.Duration(minutes) * time.Minute))
+		ready, err := m.ChangeState(running, models.StateReady, failure)
+		Expect(err).NotTo(HaveOccurred())
+
+		return ready
+	}
+
+	It("counts runs and records how long they took", func() {
+		status := run(&models.PipelineStatus{}, 5, nil)
+		Expect(status.Stats).To(Equal(&models.StatusStats{Runs: 1, LastRunSeconds: 300}))
+	})
+
+	It("records when the current run started", func() {
+		m := state.Default()
+		m.Clock = clock.Fixed(start)
+		status, err := m.ChangeState(&models.PipelineStatus{}, models.StateRunning, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Stats.RunStarted).To(Equal("2017-09-18T10:00:00+0000"))
+	})
+
+	It("counts failures until a run succeeds", func() {
+		status := run(&models.PipelineStatus{}, 1, failure)
+		status = run(status, 1, failure)
+		Expect(status.Stats.Failures).To(Equal(2))
+		Expect(status.Stats.ConsecutiveFailures).To(Equal(2))
+
+		status = run(status, 1, nil)
+		Expect(status.Stats.Runs).To(Equal(3))
+		Expect(status.Stats.Failures).To(Equal(2))
+		Expect(status.Stats.ConsecutiveFailures).To(Equal(0))
+	})
+
+	It("leaves the previous status untouched", func() {
+		first := run(&models.PipelineStatus{}, 1, nil)
+		run(first, 1, failure)
+		Expect(first.Stats.Failures).To(Equal(0))
+	})
+
+	It("records how long a build waited to start", func() {
+		status := state.RecordLockWait(&models.PipelineStatus{}, start, start.Add(90*time.Second))
+		status = state.RecordLockWait(status, start, start.Add(30*time.Second))
+		Expect(status.Stats.LastLockWaitSeconds).To(Equal(30.0))
+		Expect(status.Stats.LockWaitSeconds).To(Equal(120.0))
+
+		other := state.RecordLockWait(status, time.Time{}, start)
+		Expect(other.Stats.LockWaitSeconds).To(Equal(120.0))
+		Expect(other.Stats.LastLockWaitSeconds).To(Equal(30.0))
+	})
+})
@@ -0,0 +1,91 @@
+package state
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pivotalservices/pipeline-status-resource/models"
+)
+
+// Summarize combines the statuses stored under the given keys. The summary
+// is READY only when every status is READY without a failure. Otherwise it
+// is FAILED when any status carries a failure, RUNNING when any status is
+// running, and NOT_READY when some status is in another state.
+//
+// The summary's build number is the sum of the statuses' build numbers, so
+// it grows whenever any of the pipelines starts a run.
+func Summarize(keys []string, statuses []*models.PipelineStatus, now time.Time) *models.StatusSummary {
+	summary := &models.StatusSummary{State: models.StateReady}
+
+	total := 0
+	var lastModified time.Time
+	running, notReady := false, false
+
+	for i, status := range statuses {
+		pipeline := models.PipelineSummary{
+			Key:         keys[i],
+			Pipeline:    status.Pipeline,
+			Team:        status.Team,
+			BuildNumber: status.BuildNumber,
+			State:       status.State,
+			Failure:     status.Failure,
+			Frozen:      IsFrozen(status, now),
+
+			LastModified: status.LastModified,
+			Holders:      statusHolders(status),
+			Stats:        status.Stats,
+		}
+		summary.Pipelines = append(summary.Pipelines, pipeline)
+
+		if build, err := strconv.Atoi(status.BuildNumber); err == nil {
+			total += build
+		}
+
+		if modified, err := time.Parse(models.ISO8601DateFormat, status.LastModified); err == nil && modified.After(lastModified) {
+			lastModified = modified
+			summary.LastModified = status.LastModified
+		}
+
+		switch {
+		case status.Failure != nil:
+			summary.Failing = append(summary.Failing, keys[i])
+		case status.State == models.StateRunning:
+			running = true
+		case status.State != models.StateReady && status.State != "":
+			notReady = true
+		}
+	}
+
+	summary.BuildNumber = strconv.Itoa(total)
+
+	switch {
+	case len(summary.Failing) > 0:
+		summary.State = models.StateFailed
+	case running:
+		summary.State = models.StateRunning
+	case notReady:
+		summary.State = models.StateNotReady
+	}
+
+	return summary
+}
+
+// SummaryStatus returns a status standing in for the summary, so it can be
+// reported wherever a single status is expected. It carries the failure of
+// the first failing pipeline.
+func SummaryStatus(summary *models.StatusSummary) *models.PipelineStatus {
+	status := &models.PipelineStatus{
+		BuildNumber:  summary.BuildNumber,
+		LastModified: summary.LastModified,
+		State:        summary.State,
+	}
+
+	for _, p := range summary.Pipelines {
+		if p.Failure != nil {
+			status.Failure = p.Failure
+			break
+		}
+	}
+
+	return status
+}
@@ -0,0 +1,70 @@
+package state_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotalservices/pipeline-status-resource/models"
+	"github.com/pivotalservices/pipeline-status-resource/state"
+)
+
+var _ = Describe("Summaries", func() {
+	now := time.Date(2017, 9, 18, 10, 0, 0, 0, time.UTC)
+	keys := []string{"a.yml", "b.yml"}
+	failure := &models.BuildFailure{JobName: "deploy", BuildName: "4"}
+
+	ready := func(build string) *models.PipelineStatus {
+		return &models.PipelineStatus{
+			Pipeline:     "p" + build,
+			BuildNumber:  build,
+			LastModified: "2017-09-18T09:0" + build + ":00+0000",
+			State:        models.StateReady,
+		}
+	}
+
+	It("is ready when every status is ready", func() {
+		summary := state.Summarize(keys, []*models.PipelineStatus{ready("3"), ready("4")}, now)
+		Expect(summary.State).To(Equal(models.StateReady))
+		Expect(summary.BuildNumber).To(Equal("7"))
+		Expect(summary.LastModified).To(Equal("2017-09-18T09:04:00+0000"))
+		Expect(summary.Failing).To(BeEmpty())
+		Expect(summary.Pipelines).To(HaveLen(2))
+		Expect(summary.Pipelines[0].Key).To(Equal("a.yml"))
+		Expect(summary.Pipelines[0].Pipeline).To(Equal("p3"))
+	})
+
+	It("treats statuses that were never started as ready", func() {
+		summary := state.Summarize(keys, []*models.PipelineStatus{ready("3"), {}}, now)
+		Expect(summary.State).To(Equal(models.StateReady))
+		Expect(summary.BuildNumber).To(Equal("3"))
+	})
+
+	It("is running when any status is running", func() {
+		running := ready("4")
+		running.State = models.StateRunning
+
+		summary := state.Summarize(keys, []*models.PipelineStatus{ready("3"), running}, now)
+		Expect(summary.State).To(Equal(models.StateRunning))
+	})
+
+	It("is failed when any status carries a failure", func() {
+		running := ready("3")
+		running.State = models.StateRunning
+		failed := ready("4")
+		failed.Failure = failure
+
+		summary := state.Summarize(keys, []*models.PipelineStatus{running, failed}, now)
+		Expect(summary.State).To(Equal(models.StateFailed))
+		Expect(summary.Failing).To(Equal([]string{"b.yml"}))
+		Expect(state.SummaryStatus(summary).Failure).To(Equal(failure))
+	})
+
+	It("is not ready when any status is in another state", func() {
+		paused := ready("4")
+		paused.State = "PAUSED"
+
+		summary := state.Summarize(keys, []*models.PipelineStatus{ready("3"), paused}, now)
+		Expect(summary.State).To(Equal(models.StateNotReady))
+	})
+})
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+
+	"github.com/pivotalservices/pipeline-status-resource/driver"
+	"github.com/pivotalservices/pipeline-status-resource/logger"
+	"github.com/pivotalservices/pipeline-status-resource/server"
+)
+
+var VERSION = "local-build"
+
+var log = logger.Default
+
+func main() {
+	sourceFile := flag.String("source", "", "file holding the resource's source configuration, as JSON or YAML")
+	keyPrefix := flag.String("key-prefix", "", "prefix of the statuses to serve, overrides the source file")
+	listen := flag.String("listen", ":8080", "address to serve on")
+	cacheTTL := flag.Duration("cache-ttl", server.DefaultCacheTTL, "how long statuses are served before they are read again")
+	flag.Parse()
+
+	if *sourceFile == "" {
+		log.Error("usage: status-server -source <file> [-key-prefix <prefix>] [-listen <address>] [-cache-ttl <duration>]")
+		os.Exit(2)
+	}
+
+	source, err := driver.ReadSource(*sourceFile)
+	if err != nil {
+		fatal("reading source", err)
+	}
+
+	// An invalid log_level is reported when the driver is constructed.
+	log, _ = logger.FromSource(source)
+
+	if *keyPrefix != "" {
+		source.Key, source.Keys, source.KeyPrefix = "", nil, *keyPrefix
+	}
+
+	d, err := driver.FromSource(source)
+	if err != nil {
+		fatal("constructing driver", err)
+	}
+
+	srv := server.New(d)
+	srv.CacheTTL = *cacheTTL
+	srv.Log = log
+
+	log.Info("Serving statuses", "version", VERSION, "listen", *listen)
+	if err := http.ListenAndServe(*listen, srv); err != nil {
+		fatal("serving", err)
+	}
+}
+
+func fatal(doing string, err error) {
+	log.Error("error "+doing, "error", err)
+	os.Exit(1)
+}